@@ -1,45 +1,204 @@
 package changroup
 
 import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Ackable holds Value and Ack func which must be called after the value is processed.
+// ErrAckDeadlineExceeded is passed to original [Ackable.Ack] if a subscriber didn't ack its copy
+// after all redeliveries and there is no dead letter sink, see [WithAckDeadline].
+var ErrAckDeadlineExceeded = errors.New("changroup: ack deadline exceeded")
+
+// ErrQuorumNotReached is passed to original [Ackable.Ack] if there are not enough copies
+// which can be acked to satisfy [AckPolicy], e.g. because subscribers are released.
+var ErrQuorumNotReached = errors.New("changroup: ack quorum is not reached")
+
+// inFlightShards is the number of lists tracking in-flight values, so concurrent sends rarely wait for each other.
+const inFlightShards = 32
+
+// Ackable holds Value which must be acked with [Ackable.Ack] after it's processed. It's created with [NewAckable].
 type Ackable[T any] struct {
 	Value T
-	Ack   func()
+	ack   func(err error)
+	acker acker  // is used by copies instead of ack, so they don't allocate a func each
+	seq   uint64 // is passed to acker, so a copy of reused message can't ack the new one
 }
 
-func NewAckable[T any](value T, ack func()) Ackable[T] {
+// acker is an ack target which doesn't need a func to be allocated.
+type acker interface {
+	ack(seq uint64, err error)
+}
+
+func NewAckable[T any](value T, ack func(err error)) Ackable[T] {
 	return Ackable[T]{
 		Value: value,
-		Ack:   ack,
+		ack:   ack,
+		acker: nil,
+		seq:   0,
 	}
 }
 
+// Ack must be called after the value is processed.
+// It receives the result of processing: nil if the value is processed successfully, or an error otherwise.
+// Ack of zero value has no effect.
+func (a Ackable[T]) Ack(err error) {
+	switch {
+	case a.acker != nil:
+		a.acker.ack(a.seq, err)
+	case a.ack != nil:
+		a.ack(err)
+	}
+}
+
+// AckableGroupOption configures [AckableGroup], see [NewAckableGroup].
+type AckableGroupOption[T any] func(*ackableGroupConfig[T])
+
+type ackableGroupConfig[T any] struct {
+	policy          AckPolicy
+	ackDeadline     time.Duration
+	maxRedeliveries int
+	deadLetter      func(Ackable[T])
+	leaks           *leakDetector[T]
+	release         ReleasePolicy
+}
+
+// WithAckPolicy sets the default [AckPolicy] of the group. It can be overridden for a single value,
+// see [AckableGroup.SendWithPolicy].
+func WithAckPolicy[T any](policy AckPolicy) AckableGroupOption[T] {
+	return func(c *ackableGroupConfig[T]) {
+		c.policy = policy
+	}
+}
+
+// WithAckDeadline makes [AckableGroup] redeliver a copy of value if subscriber doesn't ack it within deadline.
+//
+// The deadline is counted from the moment the subscriber receives the copy.
+// The copy is redelivered to the same subscriber at most maxRedeliveries times.
+// After that the value is passed to the dead letter sink (see [WithDeadLetter]) or dropped if there is no sink.
+// In both cases the copy doesn't block original [Ackable.Ack] anymore.
+// Dropped copy results in [ErrAckDeadlineExceeded].
+//
+// Acking any of the delivered copies is enough. Redelivered copies may be received out of order.
+func WithAckDeadline[T any](deadline time.Duration, maxRedeliveries int) AckableGroupOption[T] {
+	return func(c *ackableGroupConfig[T]) {
+		c.ackDeadline = deadline
+		c.maxRedeliveries = maxRedeliveries
+	}
+}
+
+// WithDeadLetter sets a sink for values which were not acked by a subscriber after all redeliveries.
+//
+// The sink receives a new [Ackable] value. The subscriber's copy is considered acked when the sink acks it,
+// the error passed to the sink's ack is the result of the copy.
+// The option makes sense only together with [WithAckDeadline].
+func WithDeadLetter[T any](sink func(Ackable[T])) AckableGroupOption[T] {
+	return func(c *ackableGroupConfig[T]) {
+		c.deadLetter = sink
+	}
+}
+
+// WithDeadLetterGroup is like [WithDeadLetter], but sends dead letters to another group.
+func WithDeadLetterGroup[T any](group *AckableGroup[T]) AckableGroupOption[T] {
+	return WithDeadLetter(group.Send)
+}
+
+// SubscriberID identifies a channel acquired from [AckableGroup].
+// IDs are unique within a group.
+type SubscriberID uint64
+
+// AckReport describes what happened to the copies of a value sent by [AckableGroup.SendAndWait].
+type AckReport struct {
+	// Acked contains subscribers which acked their copy.
+	Acked []SubscriberID
+	// Released contains subscribers which were released before receiving their copy
+	// or before acking it if [ReleasePolicy] resolves such copies.
+	Released []SubscriberID
+	// Requeued contains subscribers which were released before acking their copy,
+	// and the copy was requeued to another subscriber, see [ReleaseRequeue].
+	Requeued []SubscriberID
+	// DeadLettered contains subscribers which didn't ack their copy after all redeliveries, see [WithAckDeadline].
+	DeadLettered []SubscriberID
+	// TimedOut contains subscribers which didn't ack their copy before the context was done.
+	TimedOut []SubscriberID
+	// Errors contains non-nil errors the subscribers acked their copies with.
+	Errors map[SubscriberID]error
+}
+
+// PendingValue describes a value sent to [AckableGroup] which has not resolved copies, see [AckableGroup.Pending].
+type PendingValue[T any] struct {
+	Value  T
+	SentAt time.Time
+	// Acks contains subscribers which still owe an ack.
+	Acks []PendingAck
+}
+
+// PendingAck describes a copy of value which is not resolved yet.
+type PendingAck struct {
+	Subscriber SubscriberID
+	// Received is false if the copy is still waiting to be received by subscriber.
+	Received bool
+	// HeldFor is the time passed since the subscriber received the copy.
+	HeldFor time.Duration
+	// Redeliveries is the number of times the copy was redelivered, see [WithAckDeadline].
+	Redeliveries int
+}
+
 // AckableGroup provides pub-sub model working with channels.
 //
 // Each acquired channel will receive a copy of an [Ackable] value provided to [AckableGroup.Send].
-// Original [Ackable.Ack] will be called after all copies are acked.
+// Original [Ackable.Ack] will be called after all copies are acked (see [AckPolicy] to change it).
+// It receives [errors.Join] of all errors the copies are acked with.
 type AckableGroup[T any] struct {
-	channels *list[*channel[Ackable[T]]]
+	channels *registry[*subscriber[T]]
+	inFlight [inFlightShards]*list[*message[T]] // messages are spread by seq
+	config   ackableGroupConfig[T]
+	lastID   atomic.Uint64
+	lastSeq  atomic.Uint64
+	messages sync.Pool // finished messages are reused, so a send doesn't allocate if all channels are ready
+	sends    sync.Pool // wait groups of sends
+	acks     *ackWorkers[T]
 }
 
-func NewAckableGroup[T any]() *AckableGroup[T] {
-	return &AckableGroup[T]{
-		channels: newList[*channel[Ackable[T]]](),
+func NewAckableGroup[T any](options ...AckableGroupOption[T]) *AckableGroup[T] {
+	g := &AckableGroup[T]{
+		channels: newRegistry[*subscriber[T]](),
+		inFlight: [inFlightShards]*list[*message[T]]{},
+		config: ackableGroupConfig[T]{
+			policy:          AckAll(),
+			ackDeadline:     0,
+			maxRedeliveries: 0,
+			deadLetter:      nil,
+			leaks:           nil,
+			release:         ReleaseWaitAck,
+		},
+		lastID:   atomic.Uint64{},
+		lastSeq:  atomic.Uint64{},
+		messages: sync.Pool{},
+		sends: sync.Pool{
+			New: func() any { return new(sync.WaitGroup) },
+		},
+		acks: newAckWorkers[T](),
+	}
+	g.messages.New = func() any { return g.allocMessage() }
+	for i := range g.inFlight {
+		g.inFlight[i] = newList[*message[T]]()
+	}
+	for _, option := range options {
+		option(&g.config)
 	}
+	return g
 }
 
 // ReleaseAll releases all acquired channels and closes them.
 // It's safe to call [AckableGroup.ReleaseAll] several times as well as in parallel with [ReleaseFunc].
 func (g *AckableGroup[T]) ReleaseAll() {
-	var all []*channel[Ackable[T]]
-	g.channels.ForEach(func(ch *channel[Ackable[T]]) {
-		all = append(all, ch)
-	})
-	for _, ch := range all {
-		ch.release() // there will be deadlock if call it inside ForEach.
+	for _, sub := range g.channels.RemoveAll() {
+		sub.release()
 	}
 }
 
@@ -48,31 +207,40 @@ func (g *AckableGroup[T]) ReleaseAll() {
 // [ReleaseFunc] is returned as the second value.
 // It should be called to remove the channel from the group and close it.
 // It's safe to call [ReleaseFunc] several times as well as in parallel with [AckableGroup.ReleaseAll].
-func (g *AckableGroup[T]) Acquire() (<-chan Ackable[T], ReleaseFunc) {
-	ch := g.channels.Append(&channel[Ackable[T]]{
-		ch:      make(chan Ackable[T]),
-		done:    make(chan struct{}),
-		send:    sync.WaitGroup{},
-		release: nil, // is filled below
-	})
+func (g *AckableGroup[T]) Acquire(options ...SubscriberOption) (<-chan Ackable[T], ReleaseFunc) {
+	_, ch, release := g.AcquireWithID(options...)
+	return ch, release
+}
+
+// AcquireWithID is like [AckableGroup.Acquire], but also returns ID of the subscriber.
+// The ID is used in [AckReport].
+func (g *AckableGroup[T]) AcquireWithID(options ...SubscriberOption) (SubscriberID, <-chan Ackable[T], ReleaseFunc) {
+	stack := ""
+	if g.config.leaks != nil {
+		stack = string(debug.Stack())
+	}
+	sub := newSubscriber[T](SubscriberID(g.lastID.Add(1)), stack, options)
 
 	once := sync.Once{}
-	ch.elem.release = func() {
+	sub.release = func() {
 		once.Do(func() {
-			ch.Delete()
-			close(ch.elem.done)
-			ch.elem.send.Wait()
-			close(ch.elem.ch)
+			g.channels.Remove(sub)
+			sub.close()
+			g.resolveOutstanding(sub)
 		})
 	}
 
-	return ch.elem.ch, ch.elem.release
+	g.channels.Add(sub)
+	return sub.id, sub.ch, sub.release
 }
 
 // Send sends a copy of [Ackable] value to each acquired channel.
 //
 // Each copy has its own [Ackable.Ack].
-// Original [Ackable.Ack] will be called after all copies are acked.
+// Original [Ackable.Ack] will be called after all copies are acked (or according to [WithAckPolicy]).
+// It receives [errors.Join] of all errors the copies are acked with before original ack is called.
+// Copies which are not received because of release don't block original ack, but don't count towards quorum,
+// see [AckPolicy].
 // [AckableGroup.Send] doesn't wait for ack.
 //
 // It guarantees that all channels receive the values in the same order.
@@ -80,63 +248,671 @@ func (g *AckableGroup[T]) Acquire() (<-chan Ackable[T], ReleaseFunc) {
 //
 // It waits for all channels to receive the value or to be released.
 func (g *AckableGroup[T]) Send(value Ackable[T]) {
-	send := sync.WaitGroup{}
-	ack := sync.WaitGroup{}
-	g.channels.ForEach(func(ch *channel[Ackable[T]]) {
-		ack.Add(1)
-		once := sync.Once{}
-		v := NewAckable(value.Value, func() { once.Do(ack.Done) })
-
-		// select is an optimisation to not create goroutine if someone reads the channel (should cover 90% cases)
-		select {
-		case ch.ch <- v:
-		default:
-			send.Add(1)
-			ch.send.Add(1)
-			go func() {
-				defer send.Done()
-				defer ch.send.Done()
-				select {
-				case ch.ch <- v:
-				case <-ch.done:
-					ack.Done()
-				}
-			}()
+	g.SendWithPolicy(value, g.config.policy)
+}
+
+// SendWithPolicy is like [AckableGroup.Send], but calls original [Ackable.Ack] according to the policy
+// instead of the group's one.
+func (g *AckableGroup[T]) SendWithPolicy(value Ackable[T], policy AckPolicy) {
+	send, _ := g.sends.Get().(*sync.WaitGroup) // pool contains only *sync.WaitGroup
+	subs := g.channels.Snapshot()
+	msg := g.newMessage(value, policy, len(subs), false)
+	forEachLocked(subs, func(sub *subscriber[T]) {
+		sub.deliver([]*delivery[T]{msg.newDelivery(&g.config, sub)}, send)
+	})
+	msg.sent()
+	send.Wait()
+	g.sends.Put(send)
+}
+
+// SendMany sends copies of values to each acquired channel like [AckableGroup.Send] does for each of them,
+// but with less overhead per value.
+//
+// Each channel receives all copies one after another, copies of other sends are not interleaved with them
+// (except redeliveries, see [WithAckDeadline]).
+// A channel acquired during [AckableGroup.SendMany] receives either all copies or none of them.
+// Each value is acked separately.
+//
+// It waits for all channels to receive the values or to be released.
+func (g *AckableGroup[T]) SendMany(values ...Ackable[T]) {
+	if len(values) == 0 {
+		return
+	}
+	send, _ := g.sends.Get().(*sync.WaitGroup) // pool contains only *sync.WaitGroup
+	subs := g.channels.Snapshot()
+	msgs := make([]*message[T], 0, len(values))
+	for _, value := range values {
+		msgs = append(msgs, g.newMessage(value, g.config.policy, len(subs), false))
+	}
+	forEachLocked(subs, func(sub *subscriber[T]) {
+		ds := make([]*delivery[T], 0, len(msgs))
+		for _, msg := range msgs {
+			ds = append(ds, msg.newDelivery(&g.config, sub))
 		}
+		sub.deliver(ds, send)
 	})
-	go func() {
-		ack.Wait()
-		value.Ack()
-	}()
+	for _, msg := range msgs {
+		msg.sent()
+	}
 	send.Wait()
+	g.sends.Put(send)
 }
 
 // SendAsync sends a value to each acquired channel, but unlike [AckableGroup.Send] doesn't block.
 // Also, it doesn't preserve the order of values!
 func (g *AckableGroup[T]) SendAsync(value Ackable[T]) {
-	ack := sync.WaitGroup{}
-	g.channels.ForEach(func(ch *channel[Ackable[T]]) {
-		ack.Add(1)
-		once := sync.Once{}
-		v := NewAckable(value.Value, func() { once.Do(ack.Done) })
-
-		// select is an optimisation to not create goroutine if someone reads the channel (should cover 90% cases)
-		select {
-		case ch.ch <- v:
-		default:
-			ch.send.Add(1)
-			go func() {
-				defer ch.send.Done()
-				select {
-				case ch.ch <- v:
-				case <-ch.done:
-					ack.Done()
-				}
-			}()
-		}
+	g.SendAsyncWithPolicy(value, g.config.policy)
+}
+
+// SendAsyncWithPolicy is like [AckableGroup.SendAsync], but calls original [Ackable.Ack] according to the policy
+// instead of the group's one.
+func (g *AckableGroup[T]) SendAsyncWithPolicy(value Ackable[T], policy AckPolicy) {
+	subs := g.channels.Snapshot()
+	msg := g.newMessage(value, policy, len(subs), false)
+	forEachLocked(subs, func(sub *subscriber[T]) {
+		sub.deliver([]*delivery[T]{msg.newDelivery(&g.config, sub)}, nil)
+	})
+	msg.sent()
+}
+
+// SendAndWait sends a copy of value to each acquired channel and waits until all copies are acked.
+//
+// It ignores [AckPolicy] and always waits for all copies.
+// Copies resolved without ack (see [AckReport]) don't block [AckableGroup.SendAndWait].
+// It returns [errors.Join] of all errors the copies are acked with.
+// If ctx is done earlier, it returns ctx.Err() and the report lists not acked subscribers in [AckReport.TimedOut].
+// Not yet received copies are delivered in background like in [AckableGroup.SendAsync].
+//
+// The order of values is the same as [AckableGroup.SendAndWait] calls if all of them return nil error.
+func (g *AckableGroup[T]) SendAndWait(ctx context.Context, value T) (AckReport, error) {
+	subs := g.channels.Snapshot()
+	msg := g.newMessage(NewAckable(value, nil), AckAll(), len(subs), true)
+	forEachLocked(subs, func(sub *subscriber[T]) {
+		sub.deliver([]*delivery[T]{msg.newDelivery(&g.config, sub)}, nil)
 	})
-	go func() {
-		ack.Wait()
-		value.Ack()
-	}()
+	msg.sent()
+	select {
+	case <-msg.done:
+		return msg.report(), msg.err()
+	case <-ctx.Done():
+		return msg.report(), ctx.Err()
+	}
+}
+
+// Pending returns values which copies are not resolved yet (see [AckReport]) in the order they were sent.
+// Values with no pending copies are not returned even if original [Ackable.Ack] is not called yet.
+//
+// It's useful to find out which subscriber blocks the pipeline.
+func (g *AckableGroup[T]) Pending() []PendingValue[T] {
+	type sent struct {
+		msg *message[T]
+		seq uint64 // the message may be reused until it's locked
+	}
+	var all []sent
+	for _, shard := range g.inFlight {
+		shard.ForEach(func(msg *message[T]) {
+			all = append(all, sent{msg: msg, seq: msg.seq})
+		})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	now := time.Now()
+	var pending []PendingValue[T]
+	for _, s := range all {
+		if p, ok := s.msg.pending(s.seq, now); ok {
+			pending = append(pending, p)
+		}
+	}
+	return pending
+}
+
+// newMessage takes a message from the pool and tracks it until all deliveries are resolved.
+// Deliveries for the expected number of subscribers are allocated at once.
+// wait creates [message.done], such message is not reused, because its report is read after it's finished.
+// Messages are not reused with leak detection either, because leak tokens refer to their deliveries.
+func (g *AckableGroup[T]) newMessage(value Ackable[T], policy AckPolicy, subscribers int, wait bool) *message[T] {
+	msg, _ := g.messages.Get().(*message[T]) // pool contains only *message[T]
+	msg.mu.Lock()
+	defer msg.mu.Unlock()
+	msg.seq = g.lastSeq.Add(1)
+	msg.sentAt = time.Now()
+	msg.original = value
+	msg.policy = policy
+	if len(msg.spare) < subscribers {
+		msg.spare = make([]delivery[T], subscribers)
+		for i := range msg.spare {
+			msg.spare[i].msg = msg
+		}
+	}
+	msg.reuse = !wait && g.config.leaks == nil
+	if wait {
+		msg.done = make(chan struct{})
+	}
+	g.inFlight[msg.seq%inFlightShards].AppendNode(&msg.node)
+	return msg
+}
+
+// allocMessage creates a new message for the pool.
+func (g *AckableGroup[T]) allocMessage() *message[T] {
+	var zero Ackable[T]
+	msg := &message[T]{
+		group:      g,
+		seq:        0,
+		sentAt:     time.Time{},
+		original:   zero,
+		policy:     AckAll(),
+		reuse:      false,
+		mu:         sync.Mutex{},
+		deliveries: nil,
+		spare:      nil,
+		used:       0,
+		resolved:   0,
+		succeeded:  0,
+		requeued:   0,
+		isSent:     false,
+		acked:      false,
+		done:       nil,
+		node: node[*message[T]]{
+			elem: nil,
+			prev: nil,
+			next: nil,
+			list: nil,
+		},
+	}
+	msg.node.elem = msg
+	return msg
+}
+
+// forEachLocked calls f for each not released subscriber under [channel.lock].
+func forEachLocked[T any](subs []*subscriber[T], f func(sub *subscriber[T])) {
+	for _, sub := range subs {
+		if sub.lock() {
+			f(sub)
+			sub.unlock()
+		}
+	}
+}
+
+// outcome is a reason why delivery is resolved.
+type outcome int
+
+const (
+	outcomePending outcome = iota
+	outcomeAcked
+	outcomeReleased
+	outcomeRequeued
+	outcomeDeadLettered
+)
+
+// message tracks copies of a value sent via [AckableGroup].
+// It's reused after it's finished, so anything referring to it or to its deliveries after a copy is handed off
+// must keep seq and ignore the message if seq is changed.
+type message[T any] struct {
+	group      *AckableGroup[T]
+	seq        uint64 // order of sends, it's zero while the message is in the pool
+	sentAt     time.Time
+	original   Ackable[T] // is acked when enough deliveries are resolved according to policy
+	policy     AckPolicy
+	reuse      bool // message is put back to the pool when finished
+	mu         sync.Mutex
+	deliveries []*delivery[T]
+	spare      []delivery[T] // preallocated deliveries, see newDeliveryLocked
+	used       int           // number of used spare deliveries
+	resolved   int
+	succeeded  int           // deliveries acked by subscriber with nil error
+	requeued   int           // deliveries replaced by another one, see requeue
+	isSent     bool          // all deliveries are created
+	acked      bool          // original ack is called
+	done       chan struct{} // is closed when all deliveries are resolved, exists only for SendAndWait
+	node       node[*message[T]]
+}
+
+// newDelivery creates a copy of the message for subscriber.
+func (m *message[T]) newDelivery(config *ackableGroupConfig[T], sub *subscriber[T]) *delivery[T] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.newDeliveryLocked(config, sub)
+}
+
+// newDeliveryLocked must be called under lock.
+func (m *message[T]) newDeliveryLocked(config *ackableGroupConfig[T], sub *subscriber[T]) *delivery[T] {
+	var d *delivery[T]
+	if m.used < len(m.spare) {
+		d = &m.spare[m.used]
+		m.used++
+	} else {
+		d = new(delivery[T])
+		d.msg = m
+	}
+	d.deliveryState = deliveryState[T]{
+		seq:        m.seq,
+		config:     config,
+		sub:        sub,
+		receivedAt: time.Time{},
+		outcome:    outcomePending,
+		err:        nil,
+		slot:       false,
+		attempts:   0,
+		timer:      nil,
+		resolved:   nil,
+		tokens:     0,
+		spare:      nil,
+	}
+	m.deliveries = append(m.deliveries, d)
+	return d
+}
+
+// requeue replaces not resolved delivery with a new one for another subscriber.
+// It returns nil if the delivery is already resolved.
+func (m *message[T]) requeue(d *delivery[T], seq uint64, sub *subscriber[T]) *delivery[T] {
+	m.mu.Lock()
+	if m.seq != seq || d.outcome != outcomePending {
+		m.mu.Unlock()
+		return nil
+	}
+	requeued := m.newDeliveryLocked(d.config, sub)
+	d.resolveLocked(outcomeRequeued, nil)
+	s := m.update()
+	m.mu.Unlock()
+	s.apply()
+	return requeued
+}
+
+// sent is called after all deliveries are created. The message must not be used after it by sender.
+func (m *message[T]) sent() {
+	m.mu.Lock()
+	m.isSent = true
+	s := m.update()
+	m.mu.Unlock()
+	s.apply()
+}
+
+// settlement is what must be done after update when the lock is released.
+type settlement[T any] struct {
+	msg      *message[T]
+	original Ackable[T]
+	ack      bool // original must be acked with err
+	err      error
+	finished bool // message must be put back to the pool
+}
+
+// update closes done if it's time to do it. It returns what must be done after the lock is released.
+// It must be called under lock.
+func (m *message[T]) update() settlement[T] {
+	var zero Ackable[T]
+	s := settlement[T]{
+		msg:      m,
+		original: zero,
+		ack:      false,
+		err:      nil,
+		finished: false,
+	}
+	if !m.isSent {
+		return s
+	}
+	if !m.acked {
+		if ok, err := m.quorumLocked(); ok {
+			m.acked = true
+			// SendAndWait has no original ack
+			s.ack = m.original.ack != nil || m.original.acker != nil
+			s.original = m.original
+			s.err = err
+		}
+	}
+	if m.resolved == len(m.deliveries) {
+		if m.done != nil {
+			close(m.done)
+		}
+		m.node.Delete()
+		s.finished = m.reuse
+	}
+	return s
+}
+
+// apply calls original ack in background and puts finished message back to the pool.
+// It must be called without lock, because the message may be reused right away.
+func (s settlement[T]) apply() {
+	if s.ack {
+		s.msg.group.acks.call(s.original, s.err)
+	}
+	if s.finished {
+		s.msg.recycle()
+	}
+}
+
+// recycle puts finished message back to the pool.
+// Its seq is reset, so copies of the message which are still referred to don't affect it anymore.
+func (m *message[T]) recycle() {
+	var zero Ackable[T]
+	m.mu.Lock()
+	m.seq = 0
+	m.original = zero // to not retain references
+	m.isSent = false
+	m.acked = false
+	m.resolved = 0
+	m.succeeded = 0
+	m.requeued = 0
+	m.done = nil
+	for i := range m.deliveries {
+		m.deliveries[i] = nil
+	}
+	m.deliveries = m.deliveries[:0]
+	for i := 0; i < m.used; i++ {
+		m.spare[i].sub = nil
+		m.spare[i].err = nil
+	}
+	m.used = 0
+	m.mu.Unlock()
+	m.group.messages.Put(m)
+}
+
+// quorumLocked returns true and the result for original ack if it's time to call it according to policy.
+// It must be called under lock.
+func (m *message[T]) quorumLocked() (bool, error) {
+	if m.policy.isAll() {
+		return m.resolved == len(m.deliveries), m.errLocked()
+	}
+	required := m.policy.required(len(m.deliveries) - m.requeued)
+	if m.succeeded >= required {
+		return true, m.errLocked()
+	}
+	if m.succeeded+len(m.deliveries)-m.resolved < required {
+		return true, errors.Join(ErrQuorumNotReached, m.errLocked())
+	}
+	return false, nil
+}
+
+// pending returns not resolved deliveries. It returns false if there are no such deliveries.
+// It returns false if the message is reused meanwhile, i.e. seq is changed.
+func (m *message[T]) pending(seq uint64, now time.Time) (PendingValue[T], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seq != seq {
+		var zero PendingValue[T]
+		return zero, false
+	}
+	p := PendingValue[T]{
+		Value:  m.original.Value,
+		SentAt: m.sentAt,
+		Acks:   nil,
+	}
+	for _, d := range m.deliveries {
+		if d.outcome != outcomePending {
+			continue
+		}
+		a := PendingAck{
+			Subscriber:   d.sub.id,
+			Received:     !d.receivedAt.IsZero(),
+			HeldFor:      0,
+			Redeliveries: d.attempts,
+		}
+		if a.Received {
+			a.HeldFor = now.Sub(d.receivedAt)
+		}
+		p.Acks = append(p.Acks, a)
+	}
+	return p, len(p.Acks) > 0
+}
+
+// err returns joined errors of all deliveries.
+func (m *message[T]) err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.errLocked()
+}
+
+func (m *message[T]) errLocked() error {
+	var errs []error
+	for _, d := range m.deliveries {
+		if d.err != nil {
+			errs = append(errs, d.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// report returns current state of deliveries.
+func (m *message[T]) report() AckReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := AckReport{
+		Acked:        nil,
+		Released:     nil,
+		Requeued:     nil,
+		DeadLettered: nil,
+		TimedOut:     nil,
+		Errors:       nil,
+	}
+	for _, d := range m.deliveries {
+		if d.err != nil {
+			if r.Errors == nil {
+				r.Errors = map[SubscriberID]error{}
+			}
+			r.Errors[d.sub.id] = d.err
+		}
+		switch d.outcome {
+		case outcomePending:
+			r.TimedOut = append(r.TimedOut, d.sub.id)
+		case outcomeAcked:
+			r.Acked = append(r.Acked, d.sub.id)
+		case outcomeReleased:
+			r.Released = append(r.Released, d.sub.id)
+		case outcomeRequeued:
+			r.Requeued = append(r.Requeued, d.sub.id)
+		case outcomeDeadLettered:
+			r.DeadLettered = append(r.DeadLettered, d.sub.id)
+		}
+	}
+	return r
+}
+
+// delivery is a copy of a value sent to a single subscriber.
+// It is resolved once it's acked, dead lettered or the subscriber is released before receiving the copy.
+//
+// A delivery is reused together with its message, so methods which may be called after the copy is handed off
+// take seq of the message the caller refers to and do nothing if the message is reused.
+type delivery[T any] struct {
+	msg *message[T] // is never changed, so a stale reference can lock the message to check seq
+	deliveryState[T]
+}
+
+// deliveryState is guarded by message mutex, except immutable fields.
+type deliveryState[T any] struct {
+	seq        uint64 // seq of message the delivery is created for
+	config     *ackableGroupConfig[T]
+	sub        *subscriber[T]
+	receivedAt time.Time // first time the copy is received by subscriber
+	outcome    outcome
+	err        error
+	slot       bool // delivery holds a slot of subscriber
+	attempts   int
+	timer      *time.Timer
+	resolved   chan struct{} // is closed when the delivery is resolved, exists only while a redelivery is pending
+	tokens     int           // number of alive copies, is used only for leak detection
+	spare      *leakToken[T] // token of a copy which was not sent, it's reused by the next copy
+}
+
+// handoff creates an [Ackable] to be sent to subscriber.
+// A copy which is not sent because subscriber is not ready must be given back with takeBack.
+// It must be called only by sender of the pending delivery.
+func (d *delivery[T]) handoff() Ackable[T] {
+	if d.config.leaks == nil {
+		return d.handoffLocked() // the message can't be changed until the delivery is resolved
+	}
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	return d.handoffLocked()
+}
+
+// handoffLocked is like handoff, but must be called under lock.
+func (d *delivery[T]) handoffLocked() Ackable[T] {
+	if d.config.leaks == nil {
+		return Ackable[T]{
+			Value: d.msg.original.Value,
+			ack:   nil,
+			acker: d,
+			seq:   d.seq,
+		}
+	}
+	t := d.spare
+	d.spare = nil
+	if t == nil {
+		t = newLeakTokenLocked(d)
+	}
+	t.receivedAt = time.Now() // before the handoff, so the finalizer can't run before the copy is marked received
+	return Ackable[T]{
+		Value: d.msg.original.Value,
+		ack:   nil,
+		acker: t,
+		seq:   d.seq,
+	}
+}
+
+// rehandoff is like handoff, but is used for redelivery.
+// It returns false if the delivery is already resolved.
+func (d *delivery[T]) rehandoff(seq uint64) (Ackable[T], bool) {
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	if d.msg.seq != seq || d.outcome != outcomePending {
+		var zero Ackable[T]
+		return zero, false
+	}
+	return d.handoffLocked(), true
+}
+
+// takeBack keeps the token of not sent copy for the next handoff, so no token is wasted.
+func (d *delivery[T]) takeBack(copied Ackable[T]) {
+	t, ok := copied.acker.(*leakToken[T])
+	if !ok {
+		return
+	}
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	t.receivedAt = time.Time{}
+	d.spare = t
+}
+
+func (d *delivery[T]) ack(seq uint64, err error) {
+	d.resolve(seq, outcomeAcked, err)
+}
+
+// resolve sets outcome and result of delivery if it is still pending.
+func (d *delivery[T]) resolve(seq uint64, o outcome, err error) {
+	d.msg.mu.Lock()
+	if d.msg.seq != seq || !d.resolveLocked(o, err) {
+		d.msg.mu.Unlock()
+		return
+	}
+	s := d.msg.update()
+	d.msg.mu.Unlock()
+	s.apply()
+}
+
+// resolveLocked is like resolve, but doesn't update message. It must be called under lock.
+// It returns false if the delivery is already resolved.
+func (d *delivery[T]) resolveLocked(o outcome, err error) bool {
+	if d.outcome != outcomePending {
+		return false
+	}
+	d.outcome = o
+	d.err = err
+	if d.slot {
+		d.slot = false
+		<-d.sub.slots
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.resolved != nil {
+		close(d.resolved)
+		d.resolved = nil
+	}
+	if d.config.release != ReleaseWaitAck {
+		d.sub.untrack(d)
+	}
+	d.msg.resolved++
+	switch {
+	case o == outcomeAcked && err == nil:
+		d.msg.succeeded++
+	case o == outcomeRequeued:
+		d.msg.requeued++
+	}
+	return true
+}
+
+// holdSlot marks that delivery holds a slot of subscriber, see [WithMaxInFlight].
+// It gives the slot back and returns false if the delivery is already resolved.
+func (d *delivery[T]) holdSlot(seq uint64) bool {
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	if d.msg.seq != seq || d.outcome != outcomePending {
+		<-d.sub.slots
+		return false
+	}
+	d.slot = true
+	return true
+}
+
+// freeSlot gives back the slot held by delivery which is not sent after all.
+func (d *delivery[T]) freeSlot(seq uint64) {
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	if d.msg.seq == seq && d.slot {
+		d.slot = false
+		<-d.sub.slots
+	}
+}
+
+// delivered is called after subscriber received the copy. It starts ack deadline timer.
+func (d *delivery[T]) delivered(seq uint64) {
+	d.msg.mu.Lock()
+	defer d.msg.mu.Unlock()
+	if d.msg.seq != seq {
+		return
+	}
+	if d.receivedAt.IsZero() {
+		d.receivedAt = time.Now()
+	}
+	if d.config.release != ReleaseWaitAck && d.outcome == outcomePending {
+		d.sub.track(d, seq)
+	}
+	if d.config.ackDeadline <= 0 || d.outcome != outcomePending {
+		return
+	}
+	d.timer = time.AfterFunc(d.config.ackDeadline, func() { d.expire(seq) })
+}
+
+// expire is called when ack deadline is exceeded. It redelivers the copy or sends it to dead letter sink.
+func (d *delivery[T]) expire(seq uint64) {
+	d.msg.mu.Lock()
+	if d.msg.seq != seq || d.outcome != outcomePending {
+		d.msg.mu.Unlock()
+		return
+	}
+	d.timer = nil
+	d.attempts++
+	redeliver := d.attempts <= d.config.maxRedeliveries
+	var resolved chan struct{}
+	if redeliver {
+		d.resolved = make(chan struct{})
+		resolved = d.resolved
+	}
+	value := d.msg.original.Value
+	d.msg.mu.Unlock()
+
+	if !redeliver {
+		if d.config.deadLetter == nil {
+			d.resolve(seq, outcomeDeadLettered, ErrAckDeadlineExceeded)
+			return
+		}
+		d.config.deadLetter(NewAckable(value, func(err error) { d.resolve(seq, outcomeDeadLettered, err) }))
+		return
+	}
+
+	if !d.sub.addSend() {
+		d.resolve(seq, outcomeReleased, nil)
+		return
+	}
+	defer d.sub.send.Done()
+	d.sub.redeliver(d, seq, resolved)
 }
@@ -1,11 +1,14 @@
 package changroup_test
 
 import (
+	"context"
+	"errors"
 	"math/rand"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/maratori/changroup"
@@ -16,12 +19,12 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
 		t.Parallel()
 		group := changroup.NewAckableGroup[int]()
-		assertDoesNotStuck(t, group.Send, changroup.NewAckable(1, func() {}))
-		assertDoesNotStuck(t, group.Send, changroup.NewAckable(2, func() {}))
-		assertDoesNotStuck(t, group.Send, changroup.NewAckable(3, func() {}))
-		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(4, func() {}))
-		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(5, func() {}))
-		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(6, func() {}))
+		assertDoesNotStuck(t, group.Send, changroup.NewAckable(1, func(error) {}))
+		assertDoesNotStuck(t, group.Send, changroup.NewAckable(2, func(error) {}))
+		assertDoesNotStuck(t, group.Send, changroup.NewAckable(3, func(error) {}))
+		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(4, func(error) {}))
+		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(5, func(error) {}))
+		assertDoesNotStuck(t, group.SendAsync, changroup.NewAckable(6, func(error) {}))
 	})
 	t.Run("release closes channel", func(t *testing.T) {
 		t.Parallel()
@@ -30,6 +33,12 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		release()
 		assertChanClosed(t, ch)
 	})
+	t.Run("ack of zero value has no effect", func(t *testing.T) {
+		t.Parallel()
+		var zero changroup.Ackable[int]
+		zero.Ack(nil)
+		changroup.NewAckable(1, nil).Ack(nil)
+	})
 	t.Run("release can be called twice", func(t *testing.T) {
 		t.Parallel()
 		group := changroup.NewAckableGroup[int]()
@@ -81,10 +90,10 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		ch1, _ := group.Acquire()
 		ch2, release := group.Acquire()
 		release()
-		go group.Send(changroup.NewAckable(1, func() {}))
+		go group.Send(changroup.NewAckable(1, func(error) {}))
 		require.Equal(t, 1, waitChan(t, ch1).Value)
 		assertChanClosed(t, ch2)
-		group.SendAsync(changroup.NewAckable(2, func() {}))
+		group.SendAsync(changroup.NewAckable(2, func(error) {}))
 		require.Equal(t, 2, waitChan(t, ch1).Value)
 		assertChanClosed(t, ch2)
 	})
@@ -95,17 +104,17 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		ch1, _ := group.Acquire()
 		ch2, _ := group.Acquire()
 		done := make(chan struct{})
-		group.SendAsync(changroup.NewAckable(1, func() { close(done) }))
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
 		r1 := waitChan(t, ch1)
 		r2 := waitChan(t, ch2)
 		require.Equal(t, 1, r1.Value)
 		require.Equal(t, 1, r2.Value)
 		assertChanBlocked(t, done)
-		r1.Ack()
-		r1.Ack() // no effect
-		r1.Ack() // no effect
+		r1.Ack(nil)
+		r1.Ack(nil) // no effect
+		r1.Ack(nil) // no effect
 		assertChanBlocked(t, done)
-		r2.Ack()
+		r2.Ack(nil)
 		waitChan(t, done)
 	})
 	t.Run("ack happens once for Send", func(t *testing.T) {
@@ -114,17 +123,17 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		ch1, _ := group.Acquire()
 		ch2, _ := group.Acquire()
 		done := make(chan struct{})
-		go group.Send(changroup.NewAckable(1, func() { close(done) }))
+		go group.Send(changroup.NewAckable(1, func(error) { close(done) }))
 		r1 := waitChan(t, ch1)
 		r2 := waitChan(t, ch2)
 		require.Equal(t, 1, r1.Value)
 		require.Equal(t, 1, r2.Value)
 		assertChanBlocked(t, done)
-		r1.Ack()
-		r1.Ack() // no effect
-		r1.Ack() // no effect
+		r1.Ack(nil)
+		r1.Ack(nil) // no effect
+		r1.Ack(nil) // no effect
 		assertChanBlocked(t, done)
-		r2.Ack()
+		r2.Ack(nil)
 		waitChan(t, done)
 	})
 	t.Run("concurrency", func(t *testing.T) {
@@ -145,7 +154,7 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		go func() {
 			defer func() { done <- struct{}{} }()
 			for {
-				group.Send(changroup.NewAckable(struct{}{}, func() {}))
+				group.Send(changroup.NewAckable(struct{}{}, func(error) {}))
 				select {
 				case <-time.After(randDuration()):
 				case <-stop:
@@ -156,7 +165,7 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		go func() {
 			defer func() { done <- struct{}{} }()
 			for {
-				group.SendAsync(changroup.NewAckable(struct{}{}, func() {}))
+				group.SendAsync(changroup.NewAckable(struct{}{}, func(error) {}))
 				select {
 				case <-time.After(randDuration()):
 				case <-stop:
@@ -197,3 +206,489 @@ func TestAckableChanGroup(t *testing.T) { //nolint:gocognit // yeah
 		}
 	})
 }
+
+func TestAckableGroupAckDeadline(t *testing.T) {
+	t.Parallel()
+	const deadline = 50 * time.Millisecond
+	t.Run("redelivers unacked copy", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](deadline, 2))
+		ch, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		require.Equal(t, 1, waitChan(t, ch).Value)
+		r := waitChan(t, ch)
+		require.Equal(t, 1, r.Value)
+		assertChanBlocked(t, done)
+		waitRedeliveries(t, group, 2) // the next redelivery waits for the channel, but the ack cancels it
+		r.Ack(nil)
+		waitChan(t, done)
+		require.Empty(t, group.Pending())
+		assertChanBlocked(t, ch)
+	})
+	t.Run("ack of previous copy stops redelivery", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](deadline, 5))
+		ch, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		r := waitChan(t, ch)
+		waitChan(t, ch) // redelivered
+		waitRedeliveries(t, group, 2)
+		r.Ack(nil)
+		waitChan(t, done)
+		require.Empty(t, group.Pending())
+		assertChanBlocked(t, ch)
+	})
+	t.Run("drops copy after max redeliveries without dead letter", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](deadline, 1))
+		ch, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		waitChan(t, ch)
+		waitChan(t, ch)
+		waitChan(t, done)
+		assertChanBlocked(t, ch)
+	})
+	t.Run("sends to dead letter after max redeliveries", func(t *testing.T) {
+		t.Parallel()
+		dead := make(chan changroup.Ackable[int], 1)
+		group := changroup.NewAckableGroup(
+			changroup.WithAckDeadline[int](deadline, 0),
+			changroup.WithDeadLetter(func(a changroup.Ackable[int]) { dead <- a }),
+		)
+		ch, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		waitChan(t, ch)
+		d := waitChan(t, dead)
+		require.Equal(t, 1, d.Value)
+		assertChanBlocked(t, done)
+		d.Ack(nil)
+		waitChan(t, done)
+	})
+	t.Run("sends to dead letter group", func(t *testing.T) {
+		t.Parallel()
+		deadGroup := changroup.NewAckableGroup[int]()
+		dead, _ := deadGroup.Acquire()
+		group := changroup.NewAckableGroup(
+			changroup.WithAckDeadline[int](deadline, 0),
+			changroup.WithDeadLetterGroup(deadGroup),
+		)
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		waitChan(t, ch1).Ack(nil)
+		waitChan(t, ch2)
+		d := waitChan(t, dead)
+		require.Equal(t, 1, d.Value)
+		assertChanBlocked(t, done)
+		d.Ack(nil)
+		waitChan(t, done)
+	})
+	t.Run("release resolves pending redelivery", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](deadline, 1))
+		ch, release := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+		waitChan(t, ch)
+		waitRedeliveries(t, group, 1) // redelivery is blocked because no one reads ch
+		release()
+		waitChan(t, done)
+	})
+}
+
+// waitRedeliveries waits until the only pending copy is redelivered n times.
+// A redelivery is counted before the copy is sent, and the next deadline starts only after it's received.
+// So the number is stable while the channel is not read.
+func waitRedeliveries(t *testing.T, group *changroup.AckableGroup[int], n int) {
+	t.Helper()
+	waitCondition(t, func() bool {
+		pending := group.Pending()
+		return len(pending) == 1 && len(pending[0].Acks) == 1 && pending[0].Acks[0].Redeliveries == n
+	})
+}
+
+func TestAckableGroupSendAndWait(t *testing.T) {
+	t.Parallel()
+	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		report, err := group.SendAndWait(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, changroup.AckReport{}, report)
+	})
+	t.Run("waits for all acks", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		id1, ch1, _ := group.AcquireWithID()
+		id2, ch2, _ := group.AcquireWithID()
+		require.NotEqual(t, id1, id2)
+		done := make(chan changroup.AckReport)
+		go func() {
+			report, err := group.SendAndWait(context.Background(), 1)
+			assert.NoError(t, err)
+			done <- report
+		}()
+		r1 := waitChan(t, ch1)
+		r2 := waitChan(t, ch2)
+		require.Equal(t, 1, r1.Value)
+		require.Equal(t, 1, r2.Value)
+		r1.Ack(nil)
+		assertChanBlocked(t, done)
+		r2.Ack(nil)
+		report := waitChan(t, done)
+		require.ElementsMatch(t, []changroup.SubscriberID{id1, id2}, report.Acked)
+		require.Empty(t, report.Released)
+		require.Empty(t, report.DeadLettered)
+		require.Empty(t, report.TimedOut)
+	})
+	t.Run("reports released and timed out", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		id1, ch1, _ := group.AcquireWithID()
+		id2, _, release2 := group.AcquireWithID()
+		id3, ch3, _ := group.AcquireWithID()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan changroup.AckReport)
+		go func() {
+			report, err := group.SendAndWait(ctx, 1)
+			assert.Equal(t, context.Canceled, err)
+			done <- report
+		}()
+		waitChan(t, ch1).Ack(nil)
+		waitChan(t, ch3) // not acked
+		release2()
+		cancel()
+		report := waitChan(t, done)
+		require.Equal(t, []changroup.SubscriberID{id1}, report.Acked)
+		require.Equal(t, []changroup.SubscriberID{id2}, report.Released)
+		require.Empty(t, report.DeadLettered)
+		require.Equal(t, []changroup.SubscriberID{id3}, report.TimedOut)
+	})
+	t.Run("reports dead lettered", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](50*time.Millisecond, 0))
+		id, ch, _ := group.AcquireWithID()
+		done := make(chan changroup.AckReport)
+		go func() {
+			report, err := group.SendAndWait(context.Background(), 1)
+			assert.True(t, errors.Is(err, changroup.ErrAckDeadlineExceeded))
+			done <- report
+		}()
+		waitChan(t, ch)
+		report := waitChan(t, done)
+		require.Equal(t, []changroup.SubscriberID{id}, report.DeadLettered)
+	})
+	t.Run("context is done before delivery", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		id, ch, _ := group.AcquireWithID()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		report, err := group.SendAndWait(ctx, 1)
+		require.Equal(t, context.DeadlineExceeded, err)
+		require.Equal(t, []changroup.SubscriberID{id}, report.TimedOut)
+		require.Equal(t, 1, waitChan(t, ch).Value) // delivered in background
+	})
+}
+
+func TestAckableGroupAckErrors(t *testing.T) {
+	t.Parallel()
+	t.Run("original ack receives joined errors", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		ch3, _ := group.Acquire()
+		err1 := errors.New("err1")
+		err3 := errors.New("err3")
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch1).Ack(err1)
+		waitChan(t, ch2).Ack(nil)
+		waitChan(t, ch3).Ack(err3)
+		err := waitChan(t, done)
+		require.True(t, errors.Is(err, err1))
+		require.True(t, errors.Is(err, err3))
+	})
+	t.Run("original ack receives nil if all copies are acked with nil", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch1, _ := group.Acquire()
+		_, release2 := group.Acquire()
+		release2()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch1).Ack(nil)
+		require.NoError(t, waitChan(t, done))
+	})
+	t.Run("only the first ack counts", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		r := waitChan(t, ch)
+		r.Ack(nil)
+		r.Ack(errors.New("ignored"))
+		require.NoError(t, waitChan(t, done))
+	})
+	t.Run("ack of previous value's copy doesn't affect the next value", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		first := waitChan(t, ch)
+		first.Ack(nil)
+		require.NoError(t, waitChan(t, done))
+		group.SendAsync(changroup.NewAckable(2, func(err error) { done <- err })) // state of the first value is reused
+		second := waitChan(t, ch)
+		first.Ack(errors.New("ignored"))
+		time.Sleep(10 * time.Millisecond)
+		assertChanBlocked(t, done)
+		second.Ack(nil)
+		require.NoError(t, waitChan(t, done))
+	})
+	t.Run("dropped copy results in ErrAckDeadlineExceeded", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](50*time.Millisecond, 0))
+		ch, _ := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch)
+		require.True(t, errors.Is(waitChan(t, done), changroup.ErrAckDeadlineExceeded))
+	})
+	t.Run("dead letter error is passed to original ack", func(t *testing.T) {
+		t.Parallel()
+		deadErr := errors.New("dead")
+		group := changroup.NewAckableGroup(
+			changroup.WithAckDeadline[int](50*time.Millisecond, 0),
+			changroup.WithDeadLetter(func(a changroup.Ackable[int]) { a.Ack(deadErr) }),
+		)
+		ch, _ := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch)
+		require.True(t, errors.Is(waitChan(t, done), deadErr))
+	})
+	t.Run("SendAndWait returns joined errors", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		id1, ch1, _ := group.AcquireWithID()
+		_, ch2, _ := group.AcquireWithID()
+		err1 := errors.New("err1")
+		type result struct {
+			report changroup.AckReport
+			err    error
+		}
+		done := make(chan result)
+		go func() {
+			report, err := group.SendAndWait(context.Background(), 1)
+			done <- result{report: report, err: err}
+		}()
+		waitChan(t, ch1).Ack(err1)
+		waitChan(t, ch2).Ack(nil)
+		res := waitChan(t, done)
+		require.True(t, errors.Is(res.err, err1))
+		require.Len(t, res.report.Acked, 2)
+		require.Equal(t, map[changroup.SubscriberID]error{id1: err1}, res.report.Errors)
+	})
+}
+
+func TestAckableGroupPending(t *testing.T) {
+	t.Parallel()
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		require.Empty(t, group.Pending())
+	})
+	t.Run("values are listed in the order they were sent", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		_, _ = group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBuffer))
+		const n = 100
+		for i := 0; i < n; i++ {
+			group.Send(changroup.NewAckable(i, func(error) {}))
+		}
+		pending := group.Pending()
+		require.Len(t, pending, n)
+		for i, p := range pending {
+			require.Equal(t, i, p.Value)
+		}
+	})
+	t.Run("lists subscribers which owe an ack", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		id1, ch1, _ := group.AcquireWithID()
+		id2, ch2, _ := group.AcquireWithID()
+		before := time.Now()
+		go func() {
+			group.Send(changroup.NewAckable(1, func(error) {}))
+			group.Send(changroup.NewAckable(2, func(error) {}))
+		}()
+
+		r1 := waitChan(t, ch1)
+		require.Equal(t, 1, r1.Value)
+		r1.Ack(nil)
+		r2 := waitChan(t, ch2)
+		require.Equal(t, 1, r2.Value)
+		time.Sleep(50 * time.Millisecond)
+
+		// the copy is marked as received by sender after handoff, so there is no exact lower bound of HeldFor
+		var pending []changroup.PendingValue[int]
+		waitCondition(t, func() bool {
+			pending = group.Pending()
+			return len(pending) == 2 && len(pending[0].Acks) == 1 && pending[0].Acks[0].Received
+		})
+		heldAtMost := time.Since(before)
+		require.Len(t, pending, 2)
+
+		require.Equal(t, 1, pending[0].Value)
+		require.False(t, pending[0].SentAt.Before(before))
+		require.Len(t, pending[0].Acks, 1)
+		require.Equal(t, id2, pending[0].Acks[0].Subscriber)
+		require.True(t, pending[0].Acks[0].Received)
+		require.True(t, pending[0].Acks[0].HeldFor > 0)
+		require.True(t, pending[0].Acks[0].HeldFor <= heldAtMost)
+
+		require.Equal(t, 2, pending[1].Value)
+		require.Len(t, pending[1].Acks, 2)
+		require.Equal(t, id1, pending[1].Acks[0].Subscriber)
+		require.False(t, pending[1].Acks[0].Received)
+		require.Equal(t, time.Duration(0), pending[1].Acks[0].HeldFor)
+		require.Equal(t, id2, pending[1].Acks[1].Subscriber)
+
+		r2.Ack(nil)
+		waitChan(t, ch1).Ack(nil)
+		waitChan(t, ch2).Ack(nil)
+		require.Empty(t, group.Pending())
+	})
+	t.Run("reports redeliveries", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](time.Millisecond, 5))
+		ch, _ := group.Acquire()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		waitChan(t, ch)
+		waitRedeliveries(t, group, 1)
+		pending := group.Pending()
+		require.Len(t, pending, 1)
+		require.Len(t, pending[0].Acks, 1)
+		require.Equal(t, 1, pending[0].Acks[0].Redeliveries) // the redelivered copy is not received yet
+		waitChan(t, ch).Ack(nil)
+		require.Empty(t, group.Pending())
+	})
+}
+
+func TestAckableGroupSendMany(t *testing.T) {
+	t.Parallel()
+	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		done := make(chan struct{})
+		assertDoesNotStuck(t, func(values []changroup.Ackable[int]) { group.SendMany(values...) },
+			[]changroup.Ackable[int]{changroup.NewAckable(1, func(error) { close(done) })})
+		waitChan(t, done)
+	})
+	t.Run("each value is acked separately", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		done1 := make(chan struct{})
+		done2 := make(chan struct{})
+		go group.SendMany(
+			changroup.NewAckable(1, func(error) { close(done1) }),
+			changroup.NewAckable(2, func(error) { close(done2) }),
+		)
+		r11 := waitChan(t, ch1)
+		r12 := waitChan(t, ch1)
+		r21 := waitChan(t, ch2)
+		r22 := waitChan(t, ch2)
+		require.Equal(t, []int{1, 2, 1, 2}, []int{r11.Value, r12.Value, r21.Value, r22.Value})
+		r12.Ack(nil)
+		r22.Ack(nil)
+		waitChan(t, done2)
+		assertChanBlocked(t, done1)
+		r11.Ack(nil)
+		r21.Ack(nil)
+		waitChan(t, done1)
+	})
+	t.Run("other sends are not interleaved", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire(changroup.WithMaxInFlight(2, changroup.OverflowBlock))
+		const n = 10
+		values := make([]changroup.Ackable[int], n)
+		for i := range values {
+			values[i] = changroup.NewAckable(i, func(error) {})
+		}
+		go group.SendMany(values...)
+		go group.SendMany(values...)
+		go group.Send(changroup.NewAckable(-1, func(error) {}))
+		group.SendAsync(changroup.NewAckable(-2, func(error) {}))
+		for received := 0; received < 2*n; {
+			r := waitChan(t, ch)
+			r.Ack(nil)
+			if r.Value < 0 {
+				continue
+			}
+			require.Equal(t, 0, r.Value)
+			for i := 1; i < n; i++ {
+				r := waitChan(t, ch)
+				r.Ack(nil)
+				require.Equal(t, i, r.Value)
+			}
+			received += n
+		}
+	})
+	t.Run("other sends are not interleaved with buffered batch", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBuffer))
+		group.SendAsync(changroup.NewAckable(-1, func(error) {}))
+		group.SendMany(changroup.NewAckable(1, func(error) {}), changroup.NewAckable(2, func(error) {}))
+		group.SendAsync(changroup.NewAckable(-2, func(error) {}))
+		for _, want := range []int{-1, 1, 2, -2} {
+			r := waitChan(t, ch)
+			require.Equal(t, want, r.Value)
+			r.Ack(nil)
+		}
+	})
+	t.Run("channel acquired during SendMany receives nothing", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch1, _ := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendMany(changroup.NewAckable(1, func(error) {}), changroup.NewAckable(2, func(error) {}))
+		}()
+		require.Equal(t, 1, waitChan(t, ch1).Value)
+		ch2, _ := group.Acquire()
+		require.Equal(t, 2, waitChan(t, ch1).Value)
+		waitChan(t, done)
+		assertChanBlocked(t, ch2)
+	})
+	t.Run("release resolves not received copies", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, release := group.Acquire()
+		done := make(chan struct{})
+		go group.SendMany(
+			changroup.NewAckable(1, func(error) {}),
+			changroup.NewAckable(2, func(err error) {
+				assert.NoError(t, err)
+				close(done)
+			}),
+		)
+		waitChan(t, ch).Ack(nil)
+		release()
+		waitChan(t, done)
+	})
+}
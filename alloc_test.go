@@ -0,0 +1,95 @@
+package changroup_test
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestGroupAllocs(t *testing.T) { //nolint:paralleltest // allocations are measured for the whole process
+	if testing.Short() {
+		t.Skip("long test")
+	}
+	for name, newGroup := range groupEngines() {
+		newGroup := newGroup
+		t.Run(name, func(t *testing.T) { //nolint:paralleltest // allocations are measured for the whole process
+			values := []int{1} // unbuffered channel can't be ready to receive more than one value at once
+			sends := map[string]func(*changroup.Group[int]){
+				"Send":             func(g *changroup.Group[int]) { g.Send(1) },
+				"SendMany":         func(g *changroup.Group[int]) { g.SendMany(values...) },
+				"SendAsync":        func(g *changroup.Group[int]) { g.SendAsync(1) },
+				"SendAsyncOrdered": func(g *changroup.Group[int]) { g.SendAsyncOrdered(1) },
+			}
+			for name, send := range sends {
+				send := send
+				t.Run(name, func(t *testing.T) { //nolint:paralleltest // allocations are measured for the whole process
+					const subscribers = 10
+					group := newGroup()
+					defer group.ReleaseAll()
+					received := readAll(group, subscribers)
+					expected := int64(0)
+					allocs := testing.AllocsPerRun(1000, func() {
+						send(group)
+						expected += subscribers
+						for atomic.LoadInt64(received) < expected {
+							runtime.Gosched() // let readers be ready for the next value
+						}
+					})
+					require.Zero(t, allocs)
+				})
+			}
+		})
+	}
+}
+
+// readAll acquires n channels and reads them until they are released.
+// It returns the counter of received values.
+func readAll(group *changroup.Group[int], n int) *int64 {
+	received := new(int64)
+	for i := 0; i < n; i++ {
+		ch, _ := group.Acquire()
+		go func() {
+			for range ch {
+				atomic.AddInt64(received, 1)
+			}
+		}()
+	}
+	return received
+}
+
+func TestAckableGroupAllocs(t *testing.T) { //nolint:paralleltest // allocations are measured for the whole process
+	if testing.Short() {
+		t.Skip("long test")
+	}
+	if raceEnabled {
+		t.Skip("sync.Pool drops values randomly with race detector")
+	}
+	const subscribers = 10
+	group := changroup.NewAckableGroup[int]()
+	defer group.ReleaseAll()
+	received := new(int64)
+	for i := 0; i < subscribers; i++ {
+		ch, _ := group.Acquire()
+		go func() {
+			for v := range ch {
+				v.Ack(nil)
+				atomic.AddInt64(received, 1)
+			}
+		}()
+	}
+	acked := new(int64)
+	ack := func(error) { atomic.AddInt64(acked, 1) }
+	expected := int64(0)
+	allocs := testing.AllocsPerRun(1000, func() {
+		group.Send(changroup.NewAckable(1, ack))
+		expected++
+		for atomic.LoadInt64(received) < expected*subscribers || atomic.LoadInt64(acked) < expected {
+			runtime.Gosched() // let readers be ready for the next value and the value be reused
+		}
+	})
+	require.Zero(t, allocs)
+}
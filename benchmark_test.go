@@ -0,0 +1,123 @@
+package changroup_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/maratori/changroup"
+)
+
+func BenchmarkGroup(b *testing.B) {
+	engines := []struct {
+		name    string
+		options []changroup.GroupOption[int]
+	}{
+		{name: "default", options: nil},
+		{name: "dispatcher", options: []changroup.GroupOption[int]{changroup.WithDispatcher[int]()}},
+	}
+	sends := []struct {
+		name    string
+		newSend func() func(*changroup.Group[int], int) // is called for each run, so runs don't share state
+	}{
+		{name: "Send", newSend: sendSingle((*changroup.Group[int]).Send)},
+		{name: "SendAsync", newSend: sendSingle((*changroup.Group[int]).SendAsync)},
+		{name: "SendMany-100", newSend: func() func(*changroup.Group[int], int) {
+			return sendBatched(100) //nolint:mnd // batch size
+		}},
+	}
+	readers := []struct {
+		name string
+		read func(int)
+	}{
+		{name: "fast", read: func(int) {}},
+		{name: "slow", read: func(int) { runtime.Gosched() }},
+	}
+	for _, engine := range engines {
+		for _, send := range sends {
+			for _, reader := range readers {
+				for _, subscribers := range []int{1, 10, 100} {
+					name := fmt.Sprintf("%s/%s/%s-readers/%d-subscribers", engine.name, send.name, reader.name, subscribers)
+					b.Run(name, func(b *testing.B) {
+						benchmarkGroup(b, changroup.NewGroup(engine.options...), subscribers, send.newSend(), reader.read)
+					})
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkGroupFanOut(b *testing.B) {
+	engines := []struct {
+		name    string
+		options []changroup.GroupOption[int]
+	}{
+		{name: "serial", options: nil},
+		{name: "parallel", options: []changroup.GroupOption[int]{changroup.WithParallelFanOut[int](runtime.GOMAXPROCS(0))}},
+	}
+	for _, engine := range engines {
+		for _, subscribers := range []int{10, 1000, 100000} {
+			name := fmt.Sprintf("%s/%d-subscribers", engine.name, subscribers)
+			b.Run(name, func(b *testing.B) {
+				benchmarkGroup(b, changroup.NewGroup(engine.options...), subscribers, (*changroup.Group[int]).Send, func(int) {})
+			})
+		}
+	}
+}
+
+// sendSingle returns constructor of send function which sends each value separately.
+func sendSingle(send func(*changroup.Group[int], int)) func() func(*changroup.Group[int], int) {
+	return func() func(*changroup.Group[int], int) {
+		return send
+	}
+}
+
+// sendBatched returns send function which collects values and sends them with [changroup.Group.SendMany].
+func sendBatched(size int) func(*changroup.Group[int], int) {
+	batch := make([]int, 0, size)
+	return func(group *changroup.Group[int], value int) {
+		batch = append(batch, value)
+		if len(batch) == size {
+			group.SendMany(batch...)
+			batch = batch[:0]
+		}
+	}
+}
+
+// benchmarkGroup measures time to send b.N values and receive them by all subscribers.
+// It also reports the max number of goroutines observed during the benchmark.
+func benchmarkGroup(
+	b *testing.B,
+	group *changroup.Group[int],
+	subscribers int,
+	send func(*changroup.Group[int], int),
+	read func(int),
+) {
+	wg := sync.WaitGroup{}
+	wg.Add(subscribers)
+	for i := 0; i < subscribers; i++ {
+		ch, _ := group.Acquire()
+		go func() {
+			defer wg.Done()
+			for v := range ch {
+				read(v)
+			}
+		}()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	maxGoroutines := 0
+	for i := 0; i < b.N; i++ {
+		send(group, i)
+		if i%100 == 0 {
+			if n := runtime.NumGoroutine(); n > maxGoroutines {
+				maxGoroutines = n
+			}
+		}
+	}
+	group.ReleaseAll()
+	wg.Wait()
+	b.StopTimer()
+	b.ReportMetric(float64(maxGoroutines), "max-goroutines")
+}
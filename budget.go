@@ -0,0 +1,71 @@
+package changroup
+
+// BudgetPolicy defines what [Group.SendAsync] does when the goroutine budget is exhausted, see [WithAsyncBudget].
+type BudgetPolicy int
+
+const (
+	// BudgetBlock makes [Group.SendAsync] wait until one of the goroutines finishes or the channel is released.
+	BudgetBlock BudgetPolicy = iota
+	// BudgetDrop makes [Group.SendAsync] drop the value for the channel. Dropped values are counted,
+	// see [Group.Dropped].
+	BudgetDrop
+	// BudgetBuffer makes [Group.SendAsync] put the value to the unbounded queue of the channel
+	// like [Group.SendAsyncOrdered] does. The queue is drained by a single goroutine per channel.
+	BudgetBuffer
+)
+
+// WithAsyncBudget limits the number of goroutines [Group.SendAsync] starts for channels which are not ready
+// to receive. The limit is shared by all channels of the group, policy defines what happens when it's reached.
+//
+// It protects from unbounded growth of goroutines if a subscriber stalls.
+// It has no effect with [WithDispatcher], because it doesn't start goroutines per value.
+func WithAsyncBudget[T any](goroutines int, policy BudgetPolicy) GroupOption[T] {
+	return func(c *groupConfig[T]) {
+		c.budget = goroutines
+		c.budgetPolicy = policy
+	}
+}
+
+// Dropped returns the number of values dropped because of [BudgetDrop].
+// A value dropped for several channels is counted once per channel.
+func (g *Group[T]) Dropped() uint64 {
+	return g.dropped.Load()
+}
+
+// sendAsyncBudget sends the value to the channel according to [WithAsyncBudget].
+// It returns true if the value is not sent yet, because it should wait for the budget, see [Group.waitBudget].
+// It must be called under [channel.lock].
+func (g *Group[T]) sendAsyncBudget(ch *channel[T], value T) bool {
+	if ch.deliverBudget(value, g.budget) {
+		return false
+	}
+	switch g.config.budgetPolicy {
+	case BudgetBlock:
+		return true
+	case BudgetDrop:
+		g.dropped.Add(1)
+	case BudgetBuffer:
+		ch.enqueue(value)
+	}
+	return false
+}
+
+// waitBudget waits for the budget and sends the value to the channel in a new goroutine.
+// It must not be called under [channel.lock] to not prevent the channel from being released.
+func (g *Group[T]) waitBudget(ch *channel[T], value T) {
+	select {
+	case g.budget <- struct{}{}:
+	case <-ch.done:
+		return
+	}
+	if !ch.lock() {
+		<-g.budget
+		return
+	}
+	if ch.trySend(value) {
+		<-g.budget
+	} else {
+		ch.deliverLater(value, nil, g.budget)
+	}
+	ch.unlock()
+}
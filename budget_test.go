@@ -0,0 +1,94 @@
+package changroup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestWithAsyncBudget(t *testing.T) {
+	t.Parallel()
+	t.Run("block waits for goroutine to finish", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetBlock))
+		ch, _ := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendAsync(2)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, done)
+		require.Equal(t, 1, waitChan(t, ch))
+		waitChan(t, done)
+		require.Equal(t, 2, waitChan(t, ch))
+	})
+	t.Run("block is interrupted by release", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetBlock))
+		ch, release := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendAsync(2)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, done)
+		release()
+		waitChan(t, done)
+		assertChanClosed(t, ch)
+	})
+	t.Run("budget is shared by channels", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetDrop))
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		require.Equal(t, uint64(1), group.Dropped())
+		require.Equal(t, 1, waitChan(t, ch1))
+		assertChanBlocked(t, ch2)
+	})
+	t.Run("drop counts dropped values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetDrop))
+		ch, _ := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		assertDoesNotStuck(t, group.SendAsync, 2)
+		assertDoesNotStuck(t, group.SendAsync, 3)
+		require.Equal(t, uint64(2), group.Dropped())
+		require.Equal(t, 1, waitChan(t, ch))
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, ch)
+	})
+	t.Run("budget is returned when goroutine finishes", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetDrop))
+		ch, _ := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		require.Equal(t, 1, waitChan(t, ch))
+		waitCondition(t, func() bool {
+			group.SendAsync(2)
+			select {
+			case v := <-ch:
+				return v == 2
+			case <-time.After(10 * time.Millisecond):
+				return false
+			}
+		})
+	})
+	t.Run("buffer spills into queue", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithAsyncBudget[int](1, changroup.BudgetBuffer))
+		ch, _ := group.Acquire()
+		assertDoesNotStuck(t, group.SendAsync, 1)
+		assertDoesNotStuck(t, group.SendAsync, 2)
+		assertDoesNotStuck(t, group.SendAsync, 3)
+		require.Zero(t, group.Dropped())
+		require.ElementsMatch(t, []int{1, 2, 3}, []int{waitChan(t, ch), waitChan(t, ch), waitChan(t, ch)})
+	})
+}
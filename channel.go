@@ -0,0 +1,279 @@
+package changroup
+
+import "sync"
+
+// channel is a channel acquired from a group.
+type channel[T any] struct {
+	ch      chan T
+	done    chan struct{}
+	mu      sync.RWMutex // guards closing done against sends, see lock
+	send    sync.WaitGroup
+	sending sync.Mutex // is held while sending to ch to not interleave batches, see deliverMany
+	release ReleaseFunc
+	ordered fifo[queued[T]] // values waiting to be sent in order, see enqueue and dispatch
+	wake    chan struct{}   // wakes up dispatch goroutine, nil if the channel doesn't have one
+}
+
+// queued is a value waiting in the queue of channel.
+type queued[T any] struct {
+	value T
+	sent  *sync.WaitGroup // is done when the value is received or dropped because of release, may be nil
+}
+
+func newChannel[T any]() *channel[T] {
+	return &channel[T]{
+		ch:      make(chan T),
+		done:    make(chan struct{}),
+		mu:      sync.RWMutex{},
+		send:    sync.WaitGroup{},
+		sending: sync.Mutex{},
+		release: nil, // is filled by group
+		ordered: newFIFO[queued[T]](),
+		wake:    nil,
+	}
+}
+
+// lock prevents the channel from being closed. It returns false if the channel is already released.
+// It's required to send to the channel or to increment send counter. Don't block under lock.
+// unlock must be called if lock returns true.
+func (c *channel[T]) lock() bool {
+	c.mu.RLock()
+	select {
+	case <-c.done:
+		c.mu.RUnlock()
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *channel[T]) unlock() {
+	c.mu.RUnlock()
+}
+
+// addSend increments send counter unless the channel is released.
+// It must not be called under lock.
+func (c *channel[T]) addSend() bool {
+	if !c.lock() {
+		return false
+	}
+	defer c.unlock()
+	c.send.Add(1)
+	return true
+}
+
+// trySend sends the value if the channel is ready to receive it and no other value is being sent.
+func (c *channel[T]) trySend(value T) bool {
+	if !c.sending.TryLock() {
+		return false
+	}
+	defer c.sending.Unlock()
+	select {
+	case c.ch <- value:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver sends the value to the channel. If the channel is not ready, it sends in a new goroutine.
+// sent is incremented for the started goroutine (if not nil).
+// It must be called under lock.
+func (c *channel[T]) deliver(value T, sent *sync.WaitGroup) {
+	// trySend is an optimisation to not create goroutine if someone reads the channel (should cover 90% cases)
+	if c.trySend(value) {
+		return
+	}
+	c.deliverLater(value, sent, nil)
+}
+
+// deliverBudget is like deliver, but the goroutine takes a token from budget and returns it when it's done.
+// It returns false if the channel is not ready and budget is exhausted.
+// It must be called under lock.
+func (c *channel[T]) deliverBudget(value T, budget chan struct{}) bool {
+	if c.trySend(value) {
+		return true
+	}
+	select {
+	case budget <- struct{}{}:
+	default:
+		return false
+	}
+	c.deliverLater(value, nil, budget)
+	return true
+}
+
+// deliverLater sends the value to the channel in a new goroutine.
+// It's separated from deliver to not allocate the value on heap if the channel is ready.
+// The token is taken from budget (if not nil) by the caller, the goroutine returns it.
+func (c *channel[T]) deliverLater(value T, sent *sync.WaitGroup, budget chan struct{}) {
+	if sent != nil {
+		sent.Add(1)
+	}
+	c.send.Add(1)
+	go func() {
+		if budget != nil {
+			defer func() { <-budget }()
+		}
+		if sent != nil {
+			defer sent.Done()
+		}
+		defer c.send.Done()
+		c.sending.Lock()
+		defer c.sending.Unlock()
+		select {
+		case c.ch <- value:
+		case <-c.done:
+		}
+	}()
+}
+
+// deliverMany sends the values to the channel one after another, no other value is sent in between.
+// If the channel is not ready, it sends the rest of them in a new goroutine.
+// sent is incremented for the started goroutine (if not nil).
+// It must be called under lock.
+func (c *channel[T]) deliverMany(values []T, sent *sync.WaitGroup) {
+	locked := c.sending.TryLock()
+	if locked {
+	sending:
+		for len(values) > 0 {
+			select {
+			case c.ch <- values[0]:
+				values = values[1:]
+			default:
+				break sending
+			}
+		}
+		if len(values) == 0 {
+			c.sending.Unlock()
+			return
+		}
+	}
+	if sent != nil {
+		sent.Add(1)
+	}
+	c.send.Add(1)
+	go func() {
+		if sent != nil {
+			defer sent.Done()
+		}
+		defer c.send.Done()
+		if !locked {
+			c.sending.Lock()
+		}
+		defer c.sending.Unlock()
+		for _, value := range values {
+			select {
+			case c.ch <- value:
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// close stops all pending sends and closes the channel.
+// It must be called once after the channel is removed from the group.
+func (c *channel[T]) close() {
+	c.mu.Lock()
+	close(c.done)
+	c.mu.Unlock()
+	c.send.Wait()
+	close(c.ch)
+}
+
+// enqueue sends the value to the channel in order with other enqueued values without blocking.
+// It must be called under lock.
+func (c *channel[T]) enqueue(value T) {
+	c.ordered.mu.Lock()
+	defer c.ordered.mu.Unlock()
+	// trySend is an optimisation to not create goroutine if someone reads the channel
+	if c.ordered.idle() && c.trySend(value) {
+		return
+	}
+	if !c.ordered.draining {
+		c.send.Add(1)
+		c.ordered.draining = true
+		go c.drain()
+	}
+	c.ordered.items = append(c.ordered.items, queued[T]{value: value, sent: nil})
+}
+
+// drain sends enqueued values one by one until the queue is empty.
+func (c *channel[T]) drain() {
+	defer c.send.Done()
+	for {
+		item, ok := c.ordered.popOrStop()
+		if !ok {
+			return
+		}
+		c.sending.Lock()
+		select {
+		case c.ch <- item.value:
+		case <-c.done:
+		}
+		c.sending.Unlock()
+	}
+}
+
+// startDispatcher starts a long-lived goroutine sending queued values, see [WithDispatcher].
+func (c *channel[T]) startDispatcher() {
+	c.wake = make(chan struct{}, 1)
+	c.send.Add(1)
+	go c.dispatch()
+}
+
+// push puts the values to the queue of dispatch goroutine one after another.
+// sent is done for each value when it is received or dropped because of release, it may be nil.
+// It must be called under lock.
+func (c *channel[T]) push(sent *sync.WaitGroup, values ...T) {
+	if sent != nil {
+		sent.Add(len(values))
+	}
+	c.ordered.mu.Lock()
+	for _, value := range values {
+		c.ordered.items = append(c.ordered.items, queued[T]{value: value, sent: sent})
+	}
+	c.ordered.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default: // dispatch goroutine is already woken up
+	}
+}
+
+// dispatch sends queued values one by one until the channel is released.
+func (c *channel[T]) dispatch() {
+	defer c.send.Done()
+	for {
+		item, ok := c.ordered.pop()
+		if !ok {
+			select {
+			case <-c.wake:
+				continue
+			case <-c.done:
+				c.dropQueued()
+				return
+			}
+		}
+		select {
+		case c.ch <- item.value:
+		case <-c.done:
+		}
+		if item.sent != nil {
+			item.sent.Done()
+		}
+	}
+}
+
+// dropQueued removes all values from the queue after the channel is released.
+func (c *channel[T]) dropQueued() {
+	for {
+		item, ok := c.ordered.pop()
+		if !ok {
+			return
+		}
+		if item.sent != nil {
+			item.sent.Done()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package changroup
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec converts values to bytes and back. It's used by groups which store or transfer values, see [DurableGroup].
+type Codec[T any] interface {
+	Encode(value T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec is [Codec] using [encoding/json].
+type JSONCodec[T any] struct{}
+
+// Encode encodes the value to JSON.
+func (JSONCodec[T]) Encode(value T) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("changroup: json encode: %w", err)
+	}
+	return data, nil
+}
+
+// Decode decodes the value from JSON.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("changroup: json decode: %w", err)
+	}
+	return value, nil
+}
+
+// GobCodec is [Codec] using [encoding/gob]. Each value is encoded with its type description,
+// so values can be decoded independently. Interface values must be registered with [gob.Register].
+type GobCodec[T any] struct{}
+
+// Encode encodes the value to gob.
+func (GobCodec[T]) Encode(value T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, fmt.Errorf("changroup: gob encode: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the value from gob.
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return value, fmt.Errorf("changroup: gob decode: %w", err)
+	}
+	return value, nil
+}
+
+// EncodeGroup returns a new group which receives each value sent to the group encoded by the codec.
+// Values which can't be encoded are skipped and passed to onError (it may be nil).
+//
+// [ReleaseFunc] is returned as the second value. It stops encoding and releases all channels of the new group.
+// The new group is also released if the channel acquired from the original group is released.
+func EncodeGroup[T any](group *Group[T], codec Codec[T], onError func(error)) (*Group[[]byte], ReleaseFunc) {
+	return pipe(group, codec.Encode, onError)
+}
+
+// DecodeGroup is the opposite of [EncodeGroup]. It returns a new group which receives each value
+// sent to the group decoded by the codec. Values which can't be decoded are skipped and passed to onError.
+func DecodeGroup[T any](group *Group[[]byte], codec Codec[T], onError func(error)) (*Group[T], ReleaseFunc) {
+	return pipe(group, codec.Decode, onError)
+}
+
+// pipe sends values from the group converted by convert to a new group.
+func pipe[From, To any](
+	group *Group[From], convert func(From) (To, error), onError func(error),
+) (*Group[To], ReleaseFunc) {
+	out := NewGroup[To]()
+	ch, release := group.Acquire()
+	go func() {
+		defer out.ReleaseAll()
+		for value := range ch {
+			converted, err := convert(value)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			out.Send(converted)
+		}
+	}()
+	once := sync.Once{}
+	return out, func() {
+		once.Do(func() {
+			release()
+			out.ReleaseAll() // unblocks Send waiting for subscribers
+		})
+	}
+}
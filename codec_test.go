@@ -0,0 +1,99 @@
+package changroup_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+type codecValue struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodecs(t *testing.T) {
+	t.Parallel()
+	codecs := map[string]changroup.Codec[codecValue]{
+		"json": changroup.JSONCodec[codecValue]{},
+		"gob":  changroup.GobCodec[codecValue]{},
+	}
+	for name, codec := range codecs {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			value := codecValue{Name: "name", Count: 42, Tags: []string{"a", "b"}}
+			data, err := codec.Encode(value)
+			require.NoError(t, err)
+			decoded, err := codec.Decode(data)
+			require.NoError(t, err)
+			require.Equal(t, value, decoded)
+			_, err = codec.Decode([]byte("garbage"))
+			require.Error(t, err)
+		})
+	}
+	t.Run("json encode error", func(t *testing.T) {
+		t.Parallel()
+		_, err := changroup.JSONCodec[chan int]{}.Encode(make(chan int))
+		require.Error(t, err)
+	})
+	t.Run("gob encode error", func(t *testing.T) {
+		t.Parallel()
+		_, err := changroup.GobCodec[func()]{}.Encode(func() {})
+		require.Error(t, err)
+	})
+}
+
+func TestEncodeDecodeGroup(t *testing.T) {
+	t.Parallel()
+	t.Run("values are encoded and decoded", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[codecValue]()
+		encoded, releaseEncoded := changroup.EncodeGroup[codecValue](group, changroup.JSONCodec[codecValue]{}, nil)
+		defer releaseEncoded()
+		raw, _ := encoded.Acquire()
+		decoded, releaseDecoded := changroup.DecodeGroup[codecValue](encoded, changroup.JSONCodec[codecValue]{}, nil)
+		defer releaseDecoded()
+		ch, _ := decoded.Acquire()
+		value := codecValue{Name: "name", Count: 1, Tags: nil}
+		go group.Send(value)
+		require.JSONEq(t, `{"Name":"name","Count":1,"Tags":null}`, string(waitChan(t, raw)))
+		require.Equal(t, value, waitChan(t, ch))
+	})
+	t.Run("errors are passed to hook", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[[]byte]()
+		errs := make(chan error, 1)
+		decoded, release := changroup.DecodeGroup[int](group, changroup.JSONCodec[int]{}, func(err error) { errs <- err })
+		defer release()
+		ch, _ := decoded.Acquire()
+		group.Send([]byte("not a number"))
+		require.Error(t, waitChan(t, errs))
+		go group.Send([]byte("1"))
+		require.Equal(t, 1, waitChan(t, ch))
+	})
+	t.Run("release closes channels of new group", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		encoded, release := changroup.EncodeGroup[int](group, changroup.GobCodec[int]{}, nil)
+		ch, _ := encoded.Acquire()
+		go group.Send(1)
+		_, err := changroup.GobCodec[int]{}.Decode(waitChan(t, ch))
+		require.NoError(t, err)
+		release()
+		release()
+		assertChanClosed(t, ch)
+		group.Send(2) // original group has no channels anymore
+	})
+	t.Run("release of original group closes channels of new group", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		encoded, release := changroup.EncodeGroup[int](group, changroup.GobCodec[int]{}, nil)
+		defer release()
+		ch, _ := encoded.Acquire()
+		group.ReleaseAll()
+		require.Nil(t, waitChan(t, ch)) // is closed asynchronously
+	})
+}
@@ -0,0 +1,150 @@
+package changroup
+
+import (
+	"sort"
+	"time"
+)
+
+// WithCompaction makes [LogGroup] retain only the latest value for each key.
+// A value is removed from the log as soon as a newer value with the same key is sent.
+// Offsets of removed values are not reused, so retained offsets may have gaps.
+//
+// The tombstone function reports if the value deletes the key. Tombstones are retained like other values,
+// so channels acquired by [LogGroup.AcquireFrom] receive them, but [LogGroup.AcquireSnapshot] skips them.
+// A tombstone is removed by a newer value with the same key, by retention limits
+// or after [WithTombstoneRetention]. It may be nil.
+func WithCompaction[T any, K comparable](key func(value T) K, tombstone func(value T) bool) LogGroupOption[T] {
+	return func(c *logGroupConfig[T]) {
+		c.keys = func() keyIndex[T] {
+			return &keyMap[T, K]{key: key, offsets: map[K]uint64{}}
+		}
+		c.tombstone = tombstone
+	}
+}
+
+// keyIndex keeps offsets of the latest values by key, see [WithCompaction].
+// It hides the type of keys from [LogGroup], so keys are not boxed.
+type keyIndex[T any] interface {
+	// put sets the offset of the latest value with the key of the value.
+	// It returns the offset of the previous value with the same key and true if there is one.
+	put(value T, offset uint64) (uint64, bool)
+	// delete forgets the key of the value.
+	delete(value T)
+}
+
+type keyMap[T any, K comparable] struct {
+	key     func(value T) K
+	offsets map[K]uint64
+}
+
+func (m *keyMap[T, K]) put(value T, offset uint64) (uint64, bool) {
+	k := m.key(value)
+	previous, ok := m.offsets[k]
+	m.offsets[k] = offset
+	return previous, ok
+}
+
+func (m *keyMap[T, K]) delete(value T) {
+	delete(m.offsets, m.key(value))
+}
+
+// WithTombstoneRetention removes tombstones retained longer than the duration, see [WithCompaction].
+// Otherwise, a deleted key occupies memory until the tombstone is evicted by other retention limits.
+// Channels acquired by [LogGroup.AcquireFrom] after that don't receive the tombstone,
+// so consumers should catch up within the duration to notice the deletion.
+func WithTombstoneRetention[T any](age time.Duration) LogGroupOption[T] {
+	return func(c *logGroupConfig[T]) {
+		c.tombstoneAge = age
+	}
+}
+
+// AcquireSnapshot is like [LogGroup.Acquire], but the channel receives the current state first:
+// the latest retained value for each key except deleted ones, see [WithCompaction].
+// Values are received in the order they were sent. Then the channel receives values sent after the call.
+//
+// Without compaction, it's the same as [LogGroup.AcquireFrom] the oldest retained value.
+func (g *LogGroup[T]) AcquireSnapshot() (<-chan Entry[T], ReleaseFunc) {
+	g.mu.Lock()
+	backlog := make([]Entry[T], 0, len(g.entries)-g.holes)
+	for _, r := range g.entries {
+		if !r.removed && !r.tombstone {
+			backlog = append(backlog, r.entry)
+		}
+	}
+	live, releaseLive := g.group.Acquire()
+	next := g.next
+	g.mu.Unlock()
+	return g.replay(backlog, next, live, releaseLive)
+}
+
+// compact removes the previous value with the same key as the new one. It must be called under lock.
+func (g *LogGroup[T]) compact(r *retained[T]) {
+	r.tombstone = g.config.tombstone != nil && g.config.tombstone(r.entry.Value)
+	if r.tombstone && g.config.tombstoneAge > 0 {
+		g.deletes = append(g.deletes, r.entry.Offset)
+	}
+	if previous, ok := g.keys.put(r.entry.Value, r.entry.Offset); ok {
+		g.remove(g.search(previous))
+	}
+}
+
+// expireTombstones removes tombstones retained longer than [WithTombstoneRetention].
+// It returns the time until the oldest tombstone expires and false if there is no tombstone.
+// It must be called under lock.
+func (g *LogGroup[T]) expireTombstones(now time.Time) (time.Duration, bool) {
+	for len(g.deletes) > 0 {
+		offset := g.deletes[0]
+		i := g.search(offset)
+		if i == len(g.entries) || g.entries[i].entry.Offset != offset || !g.entries[i].tombstone {
+			g.deletes = g.deletes[1:] // the tombstone is already evicted or removed by a newer value
+			continue
+		}
+		if expiresIn := g.config.tombstoneAge - now.Sub(g.entries[i].at); expiresIn > 0 {
+			return expiresIn, true
+		}
+		g.deletes = g.deletes[1:]
+		g.keys.delete(g.entries[i].entry.Value)
+		g.remove(i)
+	}
+	g.deletes = nil // release the array
+	return 0, false
+}
+
+// search returns the index of the entry with the offset or the index where it would be.
+// It must be called under lock.
+func (g *LogGroup[T]) search(offset uint64) int {
+	return sort.Search(len(g.entries), func(i int) bool { return g.entries[i].entry.Offset >= offset })
+}
+
+// remove replaces the entry with a hole and squeezes holes if there are too many.
+// It must be called under lock.
+func (g *LogGroup[T]) remove(i int) {
+	g.bytes -= g.entries[i].size
+	var zero T
+	g.entries[i] = retained[T]{
+		entry:     Entry[T]{Offset: g.entries[i].entry.Offset, Value: zero}, // don't retain removed value
+		at:        time.Time{},
+		size:      0,
+		tombstone: false,
+		removed:   true,
+	}
+	g.holes++
+	for len(g.entries) > 0 && g.entries[0].removed {
+		g.evictOldest()
+	}
+	// don't let holes occupy most of the slice
+	if g.holes > len(g.entries)/2 {
+		live := g.entries[:0]
+		for _, e := range g.entries {
+			if !e.removed {
+				live = append(live, e)
+			}
+		}
+		var zero retained[T]
+		for i := len(live); i < len(g.entries); i++ {
+			g.entries[i] = zero
+		}
+		g.entries = live
+		g.holes = 0
+	}
+}
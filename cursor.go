@@ -0,0 +1,134 @@
+package changroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const cursorExt = ".cursor"
+
+// cursorStore persists offsets of named consumers, each in its own file.
+// All offsets are loaded on open and kept in memory.
+type cursorStore struct {
+	dir      string
+	syncEach bool
+	mu       sync.Mutex
+	offsets  map[string]uint64
+}
+
+func openCursorStore(dir string, syncEach bool) (*cursorStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil { //nolint:mnd // rwxr-x---
+		return nil, fmt.Errorf("changroup: create cursor directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("changroup: read cursor directory: %w", err)
+	}
+	s := &cursorStore{
+		dir:      dir,
+		syncEach: syncEach,
+		mu:       sync.Mutex{},
+		offsets:  map[string]uint64{},
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), cursorExt)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), cursorExt) || !validConsumerName(name) {
+			continue
+		}
+		offset, err := s.read(name)
+		if err != nil {
+			return nil, err
+		}
+		s.offsets[name] = offset
+	}
+	return s, nil
+}
+
+func (s *cursorStore) read(name string) (uint64, error) {
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return 0, fmt.Errorf("changroup: read cursor %q: %w", name, err)
+	}
+	offset, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("changroup: parse cursor %q: %w", name, err)
+	}
+	return offset, nil
+}
+
+// load returns the persisted offset of the consumer. It returns false if there is no one.
+func (s *cursorStore) load(name string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset, ok := s.offsets[name]
+	return offset, ok
+}
+
+// min returns the smallest persisted offset. It returns false if there are no cursors.
+func (s *cursorStore) min() (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, found := uint64(0), false
+	for _, offset := range s.offsets {
+		if !found || offset < result {
+			result, found = offset, true
+		}
+	}
+	return result, found
+}
+
+// store persists the offset of the consumer. The file is replaced atomically, so it's never torn.
+func (s *cursorStore) store(name string, offset uint64) error {
+	tmp := s.path(name) + ".tmp"
+	err := writeFile(tmp, []byte(strconv.FormatUint(offset, 10)), s.syncEach)
+	if err == nil {
+		err = os.Rename(tmp, s.path(name))
+	}
+	if err == nil && s.syncEach {
+		err = syncDir(s.dir)
+	}
+	if err != nil {
+		return fmt.Errorf("changroup: write cursor %q: %w", name, err)
+	}
+	s.mu.Lock()
+	s.offsets[name] = offset
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *cursorStore) path(name string) string {
+	return filepath.Join(s.dir, name+cursorExt)
+}
+
+// writeFile is like [os.WriteFile], but also flushes the file to disk if sync is true.
+func writeFile(path string, data []byte, sync bool) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640) //nolint:mnd // rw-r-----
+	if err != nil {
+		return err //nolint:wrapcheck // it's wrapped by caller
+	}
+	_, err = file.Write(data)
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err //nolint:wrapcheck // it's wrapped by caller
+}
+
+// validConsumerName returns true if the name can be used as a file name on any OS.
+func validConsumerName(name string) bool {
+	if name == "" || name[0] == '.' {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -6,5 +6,6 @@
 //
 // [AckableGroup] does the same, but sends [Ackable] value.
 // It calls original ack function only after all subscribers acked their copy of value.
+// Subscribers may ack with an error, original ack function receives all of them joined.
 // It's useful if you need to know when the message is processed.
 package changroup
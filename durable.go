@@ -0,0 +1,334 @@
+package changroup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by methods of closed group.
+var ErrClosed = errors.New("changroup: group is closed")
+
+var errReplayStopped = errors.New("changroup: replay is stopped")
+
+// defaultSegmentSize is the default max size of log segment file, see [WithSegmentSize].
+const defaultSegmentSize = 64 << 20
+
+// maxTrimInterval is the max interval of deleting expired segments of the log, see [WithLogRetention].
+const maxTrimInterval = time.Minute
+
+// Default delays of redelivery of values acked with an error, see [WithRedelivery].
+const (
+	defaultMinRedeliveryDelay = 100 * time.Millisecond
+	defaultMaxRedeliveryDelay = 5 * time.Second
+)
+
+// FsyncPolicy defines when [DurableGroup] flushes written values to disk, see [WithFsync].
+// Zero value is [FsyncAlways].
+type FsyncPolicy struct {
+	every time.Duration
+	never bool
+}
+
+// FsyncAlways flushes each value to disk before it's sent to subscribers.
+// It's the safest and the slowest policy.
+func FsyncAlways() FsyncPolicy {
+	return FsyncPolicy{every: 0, never: false}
+}
+
+// FsyncEvery flushes written values to disk periodically in background.
+// Values written during the last interval may be lost on crash of the OS (but not of the process).
+// Interval less or equal to zero means [FsyncAlways].
+func FsyncEvery(interval time.Duration) FsyncPolicy {
+	return FsyncPolicy{every: interval, never: false}
+}
+
+// FsyncNever leaves flushing to the OS. Values are flushed only by [DurableGroup.Close].
+func FsyncNever() FsyncPolicy {
+	return FsyncPolicy{every: 0, never: true}
+}
+
+// DurableGroupOption configures [DurableGroup], see [NewDurableGroup].
+type DurableGroupOption[T any] func(*durableGroupConfig[T])
+
+type durableGroupConfig[T any] struct {
+	fsync              FsyncPolicy
+	segmentSize        int64
+	errorHandler       func(error)
+	maxLogBytes        int64
+	maxLogAge          time.Duration
+	minRedeliveryDelay time.Duration
+	maxRedeliveryDelay time.Duration
+	maxRedeliveries    int
+}
+
+// WithFsync sets the policy of flushing values to disk. Default is [FsyncAlways].
+func WithFsync[T any](policy FsyncPolicy) DurableGroupOption[T] {
+	return func(c *durableGroupConfig[T]) {
+		c.fsync = policy
+	}
+}
+
+// WithSegmentSize sets the max size of log segment file in bytes. Default is 64 MiB.
+// A value larger than the size is written to its own segment.
+func WithSegmentSize[T any](size int64) DurableGroupOption[T] {
+	return func(c *durableGroupConfig[T]) {
+		c.segmentSize = size
+	}
+}
+
+// WithLogRetention makes [DurableGroup] delete the oldest segments of the log while its total size
+// is larger than maxBytes or the last write to the segment is older than maxAge.
+// Segments are deleted as a whole and the last one is never deleted, so the log may exceed the limits.
+// Zero limit is ignored. By default, segments are not deleted.
+// Values deleted while being replayed by [DurableGroup.AcquireReplay] are skipped and reported to [WithErrorHandler].
+//
+// The option is ignored by [DurableAckableGroup], it deletes segments once they are acked by all consumers.
+func WithLogRetention[T any](maxBytes int64, maxAge time.Duration) DurableGroupOption[T] {
+	return func(c *durableGroupConfig[T]) {
+		c.maxLogBytes = maxBytes
+		c.maxLogAge = maxAge
+	}
+}
+
+// WithErrorHandler sets the function called for errors which can't be returned to the caller,
+// e.g. failed background fsync or failed decoding of persisted value during replay.
+// By default, such errors are ignored.
+func WithErrorHandler[T any](handler func(error)) DurableGroupOption[T] {
+	return func(c *durableGroupConfig[T]) {
+		c.errorHandler = handler
+	}
+}
+
+// DurableGroup is like [Group], but each value is appended to a write-ahead log on disk before it's sent.
+//
+// The log is stored in a directory as segment files. After restart, [DurableGroup.AcquireReplay]
+// allows to receive values persisted before. [DurableGroup.Close] must be called to release resources.
+type DurableGroup[T any] struct {
+	group   *Group[T]
+	entries *Group[Entry[T]] // sends values to replays, so they switch from the log to live values by offset
+	codec   Codec[T]
+	log     *wal
+	config  durableGroupConfig[T]
+	mu      sync.Mutex    // guards sent and orders appends to the log with acquiring of replays
+	sent    chan struct{} // is closed when the last appended value is sent, see [DurableGroup.Send]
+	replays *registry[*replay]
+	stop    chan struct{} // is closed by Close to stop background fsync
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// NewDurableGroup opens or creates the log in the directory.
+// Values persisted before are not sent to subscribers acquired by [DurableGroup.Acquire],
+// use [DurableGroup.AcquireReplay] to receive them.
+func NewDurableGroup[T any](dir string, codec Codec[T], options ...DurableGroupOption[T]) (*DurableGroup[T], error) {
+	g := &DurableGroup[T]{
+		group:   NewGroup[T](),
+		entries: NewGroup[Entry[T]](),
+		codec:   codec,
+		log:     nil,
+		config: durableGroupConfig[T]{
+			fsync:              FsyncAlways(),
+			segmentSize:        defaultSegmentSize,
+			errorHandler:       nil,
+			maxLogBytes:        0,
+			maxLogAge:          0,
+			minRedeliveryDelay: defaultMinRedeliveryDelay,
+			maxRedeliveryDelay: defaultMaxRedeliveryDelay,
+			maxRedeliveries:    0,
+		},
+		mu:      sync.Mutex{},
+		sent:    make(chan struct{}),
+		replays: newRegistry[*replay](),
+		stop:    make(chan struct{}),
+		stopped: sync.WaitGroup{},
+		once:    sync.Once{},
+	}
+	close(g.sent) // nothing is being sent yet
+	for _, option := range options {
+		option(&g.config)
+	}
+	log, err := openWAL(dir, g.config.segmentSize, g.config.syncEach())
+	if err != nil {
+		return nil, err
+	}
+	g.log = log
+	if g.config.syncPeriodically() {
+		g.stopped.Add(1)
+		go func() {
+			defer g.stopped.Done()
+			log.syncEvery(g.config.fsync.every, g.stop, g.config.handleError)
+		}()
+	}
+	if g.config.maxLogAge > 0 {
+		interval := g.config.maxLogAge
+		if interval > maxTrimInterval {
+			interval = maxTrimInterval
+		}
+		g.stopped.Add(1)
+		go func() {
+			defer g.stopped.Done()
+			g.trimEvery(interval)
+		}()
+	}
+	return g, nil
+}
+
+// trimEvery deletes expired segments of the log periodically until Close is called.
+func (g *DurableGroup[T]) trimEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.trim()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// trim deletes segments of the log violating [WithLogRetention].
+func (g *DurableGroup[T]) trim() {
+	if err := g.log.trim(g.config.maxLogBytes, g.config.maxLogAge, time.Now()); err != nil {
+		g.config.handleError(err)
+	}
+}
+
+// Close releases all acquired channels, flushes values to disk and closes the log.
+// [DurableGroup.Send] returns [ErrClosed] after that. It's safe to call Close several times.
+func (g *DurableGroup[T]) Close() error {
+	var err error
+	g.once.Do(func() {
+		close(g.stop)
+		g.stopped.Wait()
+		g.ReleaseAll() // unblocks Send waiting for subscribers
+		g.mu.Lock()
+		err = g.log.close()
+		g.mu.Unlock()
+	})
+	return err
+}
+
+// ReleaseAll releases all acquired channels and closes them.
+// It's safe to call [DurableGroup.ReleaseAll] several times as well as in parallel with [ReleaseFunc].
+func (g *DurableGroup[T]) ReleaseAll() {
+	g.group.ReleaseAll()
+	for _, r := range g.replays.RemoveAll() {
+		r.release()
+	}
+}
+
+// Acquire creates new channel and adds it to group. The channel receives only values sent after the call.
+//
+// [ReleaseFunc] is returned as the second value.
+// It should be called to remove the channel from the group and close it.
+// It's safe to call [ReleaseFunc] several times as well as in parallel with [DurableGroup.ReleaseAll].
+func (g *DurableGroup[T]) Acquire() (<-chan T, ReleaseFunc) {
+	return g.group.Acquire()
+}
+
+// AcquireReplay is like [DurableGroup.Acquire], but the channel receives all persisted values first
+// (including ones persisted before restart) and then values sent after the call.
+// No value is missed or duplicated on the switch.
+//
+// [DurableGroup.Send] waits for the channel like for any other, so a slow replay slows down senders.
+// Values which can't be read or decoded are skipped and reported to [WithErrorHandler].
+func (g *DurableGroup[T]) AcquireReplay() (<-chan T, ReleaseFunc) {
+	g.mu.Lock()
+	first, next := g.log.bounds()
+	live, releaseLive := g.entries.Acquire() // values appended after bounds are sent to live
+	g.mu.Unlock()
+
+	return acquireReplay(g.replays, live, releaseLive, func(out chan<- T, done <-chan struct{}) bool {
+		return g.replay(first, next, out, done)
+	}, func(entry Entry[T]) (T, bool) {
+		return entry.Value, entry.Offset >= next // older values are replayed from the log
+	})
+}
+
+// replay sends persisted values from offset from (inclusive) to offset to (exclusive) to the channel.
+// It returns false if done is closed.
+func (g *DurableGroup[T]) replay(from, to uint64, out chan<- T, done <-chan struct{}) bool {
+	err := g.log.read(from, to, func(offset uint64, data []byte) error {
+		value, err := g.codec.Decode(data)
+		if err != nil {
+			g.config.handleError(fmt.Errorf("changroup: decode value %d: %w", offset, err))
+			return nil
+		}
+		select {
+		case out <- value:
+			return nil
+		case <-done:
+			return errReplayStopped
+		}
+	})
+	if errors.Is(err, errReplayStopped) {
+		return false
+	}
+	if err != nil {
+		g.config.handleError(err)
+	}
+	return true
+}
+
+// Send appends the value to the log and then sends it to each acquired channel like [Group.Send].
+//
+// It returns an error if the value can't be encoded or written, the value is not sent in this case.
+// Values are sent in the same order they are written, so concurrent calls wait for each other.
+// Waiting for slow channels doesn't block [DurableGroup.AcquireReplay] and [DurableGroup.Close].
+func (g *DurableGroup[T]) Send(value T) error {
+	data, err := g.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("changroup: encode value: %w", err)
+	}
+	g.mu.Lock()
+	offset, err := g.log.append(data)
+	if err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	previous := g.sent
+	sent := make(chan struct{})
+	g.sent = sent
+	g.mu.Unlock()
+	if g.config.maxLogBytes > 0 || g.config.maxLogAge > 0 {
+		g.trim()
+	}
+
+	<-previous
+	g.group.Send(value)
+	g.entries.Send(Entry[T]{Offset: offset, Value: value})
+	close(sent)
+	return nil
+}
+
+// syncEach returns true if each write must be flushed to disk.
+func (c *durableGroupConfig[T]) syncEach() bool {
+	return !c.fsync.never && c.fsync.every <= 0
+}
+
+// syncPeriodically returns true if writes must be flushed to disk in background, see [FsyncEvery].
+func (c *durableGroupConfig[T]) syncPeriodically() bool {
+	return !c.fsync.never && c.fsync.every > 0
+}
+
+func (c *durableGroupConfig[T]) handleError(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+// redeliveryDelay returns the delay before the value is received again after its copy is acked with an error.
+// The delay doubles with each copy, see [WithRedelivery].
+func (c *durableGroupConfig[T]) redeliveryDelay(copies int) time.Duration {
+	delay := c.minRedeliveryDelay
+	for i := 1; i < copies && delay < c.maxRedeliveryDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.maxRedeliveryDelay {
+		delay = c.maxRedeliveryDelay
+	}
+	return delay
+}
@@ -0,0 +1,472 @@
+package changroup
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConsumerAcquired is returned by [DurableAckableGroup.AcquireDurable]
+	// if the consumer with the same name is already acquired and not released.
+	ErrConsumerAcquired = errors.New("changroup: consumer is already acquired")
+	// ErrInvalidConsumerName is returned by [DurableAckableGroup.AcquireDurable] if the name can't be used
+	// as a file name. Allowed characters are ASCII letters, digits, '-', '_' and '.', the name must not start with '.'.
+	ErrInvalidConsumerName = errors.New("changroup: invalid consumer name")
+	// ErrRedeliveriesExhausted is reported to [WithErrorHandler] if a value is skipped by a consumer,
+	// because it's acked with an error after all redeliveries, see [WithRedelivery].
+	ErrRedeliveriesExhausted = errors.New("changroup: value is not processed after all redeliveries")
+)
+
+// cursorDir is the subdirectory of the log directory where cursors of consumers are stored.
+const cursorDir = "cursors"
+
+// DurableAckableGroup is like [DurableGroup], but sends [Ackable] values to named consumers
+// which remember their position in the log between restarts.
+//
+// Each consumer receives values starting from the first one it didn't ack before.
+// So each value is processed at least once even if the process crashes.
+// [DurableAckableGroup.Close] must be called to release resources.
+type DurableAckableGroup[T any] struct {
+	codec     Codec[T]
+	log       *wal
+	cursors   *cursorStore
+	config    durableGroupConfig[T]
+	mu        sync.Mutex    // guards fields below and orders appends to the log with notifications
+	appended  chan struct{} // is closed and replaced after each append to wake up consumers
+	consumers map[string]*consumer
+	closed    bool
+	stop      chan struct{} // is closed by Close to stop background fsync
+	stopped   sync.WaitGroup
+	once      sync.Once
+}
+
+// WithRedelivery sets how [DurableAckableGroup] redelivers a value acked with an error.
+//
+// The value is received again after minDelay, the delay doubles with each next copy up to maxDelay.
+// If the copy is acked with an error after maxRedeliveries redeliveries, the value is skipped:
+// the consumer moves past it and [ErrRedeliveriesExhausted] is reported to [WithErrorHandler].
+// Zero maxRedeliveries means no limit. Default is from 100ms to 5s without limit.
+// The option is ignored by [DurableGroup].
+func WithRedelivery[T any](minDelay, maxDelay time.Duration, maxRedeliveries int) DurableGroupOption[T] {
+	return func(c *durableGroupConfig[T]) {
+		c.minRedeliveryDelay = minDelay
+		c.maxRedeliveryDelay = maxDelay
+		c.maxRedeliveries = maxRedeliveries
+	}
+}
+
+// consumer is a channel acquired by [DurableAckableGroup.AcquireDurable].
+type consumer struct {
+	name     string
+	release  ReleaseFunc
+	mu       sync.Mutex
+	cursor   uint64              // offset of the first not acked value, it's persisted
+	acked    map[uint64]struct{} // acked values after cursor
+	pending  map[uint64]int      // values waiting for ack and the number of their last copy, other acks are ignored
+	failed   []redelivery        // values acked with an error, they are received again
+	retry    chan struct{}       // wakes up the consumer when a value is failed
+	released bool                // acks are ignored after release
+}
+
+// redelivery is a value acked with an error.
+type redelivery struct {
+	offset uint64
+	copies int       // number of copies received by the consumer so far
+	at     time.Time // the value is received again not earlier than this
+}
+
+// NewDurableAckableGroup opens or creates the log in the directory. Cursors of consumers are stored there too.
+// It accepts the same options as [NewDurableGroup], the fsync policy applies to both the log and cursors.
+func NewDurableAckableGroup[T any](
+	dir string, codec Codec[T], options ...DurableGroupOption[T],
+) (*DurableAckableGroup[T], error) {
+	g := &DurableAckableGroup[T]{
+		codec:   codec,
+		log:     nil,
+		cursors: nil,
+		config: durableGroupConfig[T]{
+			fsync:              FsyncAlways(),
+			segmentSize:        defaultSegmentSize,
+			errorHandler:       nil,
+			maxLogBytes:        0,
+			maxLogAge:          0,
+			minRedeliveryDelay: defaultMinRedeliveryDelay,
+			maxRedeliveryDelay: defaultMaxRedeliveryDelay,
+			maxRedeliveries:    0,
+		},
+		mu:        sync.Mutex{},
+		appended:  make(chan struct{}),
+		consumers: map[string]*consumer{},
+		closed:    false,
+		stop:      make(chan struct{}),
+		stopped:   sync.WaitGroup{},
+		once:      sync.Once{},
+	}
+	for _, option := range options {
+		option(&g.config)
+	}
+	cursors, err := openCursorStore(filepath.Join(dir, cursorDir), g.config.syncEach())
+	if err != nil {
+		return nil, err
+	}
+	g.cursors = cursors
+	log, err := openWAL(dir, g.config.segmentSize, g.config.syncEach())
+	if err != nil {
+		return nil, err
+	}
+	g.log = log
+	if g.config.syncPeriodically() {
+		g.stopped.Add(1)
+		go func() {
+			defer g.stopped.Done()
+			log.syncEvery(g.config.fsync.every, g.stop, g.config.handleError)
+		}()
+	}
+	return g, nil
+}
+
+// Close releases all acquired channels, flushes values to disk and closes the log.
+// [DurableAckableGroup.Send] returns [ErrClosed] after that. It's safe to call Close several times.
+func (g *DurableAckableGroup[T]) Close() error {
+	var err error
+	g.once.Do(func() {
+		close(g.stop)
+		g.stopped.Wait()
+		g.mu.Lock()
+		g.closed = true
+		g.mu.Unlock()
+		g.ReleaseAll()
+		g.mu.Lock()
+		err = g.log.close()
+		g.mu.Unlock()
+	})
+	return err
+}
+
+// ReleaseAll releases all acquired channels and closes them.
+// It's safe to call [DurableAckableGroup.ReleaseAll] several times as well as in parallel with [ReleaseFunc].
+func (g *DurableAckableGroup[T]) ReleaseAll() {
+	g.mu.Lock()
+	consumers := make([]*consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+	g.mu.Unlock()
+	for _, c := range consumers {
+		c.release()
+	}
+}
+
+// AcquireDurable creates new channel for the named consumer.
+// The channel receives values starting from the first one the consumer didn't ack before,
+// a new consumer receives all values from the beginning of the log which are not deleted yet.
+//
+// Segments of the log are deleted once all their values are acked by all consumers ever acquired,
+// so the cursor of each consumer is kept even if it's released.
+//
+// Values are received in order, but may be acked in any order. Ack with an error is reported
+// to [WithErrorHandler] and the value is received again after a delay, so it's not processed before
+// it's acked with nil error or skipped after all redeliveries, see [WithRedelivery].
+// Only the first ack of the last received copy of the value counts, other acks are ignored.
+// Values which are not acked before the channel is released are received again by the next channel of the consumer.
+// The channel is also closed if the log can't be read, the error is reported to [WithErrorHandler].
+//
+// [ReleaseFunc] is returned as the second value.
+// It should be called to close the channel and to let the consumer be acquired again.
+// It's safe to call [ReleaseFunc] several times as well as in parallel with [DurableAckableGroup.ReleaseAll].
+//
+// Only one channel of the consumer can be acquired at the same time, otherwise [ErrConsumerAcquired] is returned.
+func (g *DurableAckableGroup[T]) AcquireDurable(name string) (<-chan Ackable[T], ReleaseFunc, error) {
+	if !validConsumerName(name) {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidConsumerName, name)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, nil, ErrClosed
+	}
+	if _, ok := g.consumers[name]; ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrConsumerAcquired, name)
+	}
+	first, _ := g.log.bounds()
+	cursor, ok := g.cursors.load(name)
+	if !ok || cursor < first {
+		cursor = first // the consumer is stored at once, so the log is not deleted before it reads it
+		if err := g.cursors.store(name, cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+	c := &consumer{
+		name:     name,
+		release:  nil,
+		mu:       sync.Mutex{},
+		cursor:   cursor,
+		acked:    map[uint64]struct{}{},
+		pending:  map[uint64]int{},
+		failed:   nil,
+		retry:    make(chan struct{}, 1),
+		released: false,
+	}
+	out := make(chan Ackable[T])
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer close(out)
+		defer g.forget(c) // consume also exits on read error, the consumer must be acquirable again
+		g.consume(c, out, done)
+	}()
+	once := sync.Once{}
+	c.release = func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+	g.consumers[name] = c
+	return out, c.release, nil
+}
+
+// forget marks the consumer as released, so its acks are ignored, and lets it be acquired again.
+func (g *DurableAckableGroup[T]) forget(c *consumer) {
+	c.mu.Lock()
+	c.released = true
+	c.mu.Unlock()
+	g.mu.Lock()
+	if g.consumers[c.name] == c {
+		delete(g.consumers, c.name)
+	}
+	g.mu.Unlock()
+}
+
+// consume sends values from the log to the consumer starting from its cursor until done is closed
+// or the log can't be read.
+func (g *DurableAckableGroup[T]) consume(c *consumer, out chan<- Ackable[T], done <-chan struct{}) {
+	offset := c.cursor
+	r := g.log.reader(offset)
+	defer r.close()
+	var timer *time.Timer
+	var due <-chan time.Time // fires when the next failed value should be received again
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	redeliver := func() bool {
+		wait, ok := g.redeliver(c, out, done)
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, due = nil, nil
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		return ok
+	}
+	for {
+		g.mu.Lock()
+		_, next := g.log.bounds()
+		appended := g.appended
+		g.mu.Unlock()
+		for ; offset < next; offset++ {
+			select {
+			case <-c.retry:
+				if !redeliver() {
+					return
+				}
+			case <-due:
+				if !redeliver() {
+					return
+				}
+			default:
+			}
+			data, err := r.read()
+			if err != nil {
+				g.config.handleError(fmt.Errorf("changroup: consumer %q: %w", c.name, err))
+				return
+			}
+			value, err := g.codec.Decode(data)
+			if err != nil {
+				g.config.handleError(fmt.Errorf("changroup: consumer %q: decode value %d: %w", c.name, offset, err))
+				g.commit(c, offset) // the value is skipped, it must not block the cursor
+				continue
+			}
+			if !g.deliver(c, offset, 1, value, out, done) {
+				return
+			}
+		}
+		select {
+		case <-appended:
+		case <-c.retry:
+			if !redeliver() {
+				return
+			}
+		case <-due:
+			if !redeliver() {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// deliver sends the copy of the value to the consumer. It returns false if done is closed.
+func (g *DurableAckableGroup[T]) deliver(
+	c *consumer, offset uint64, copies int, value T, out chan<- Ackable[T], done <-chan struct{},
+) bool {
+	c.mu.Lock()
+	c.pending[offset] = copies // before the handoff, so the ack can't come earlier
+	c.mu.Unlock()
+	select {
+	case out <- NewAckable(value, func(err error) { g.ack(c, offset, copies, err) }):
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// redeliver sends failed values which are due to the consumer again.
+// It returns the time until the next failed value is due (zero if there are none) and false if done is closed.
+func (g *DurableAckableGroup[T]) redeliver(
+	c *consumer, out chan<- Ackable[T], done <-chan struct{},
+) (time.Duration, bool) {
+	now := time.Now()
+	var due []redelivery
+	wait := time.Duration(0)
+	c.mu.Lock()
+	failed := c.failed[:0]
+	for _, f := range c.failed {
+		if !f.at.After(now) {
+			due = append(due, f)
+			continue
+		}
+		failed = append(failed, f)
+		if left := f.at.Sub(now); wait == 0 || left < wait {
+			wait = left
+		}
+	}
+	c.failed = failed
+	c.mu.Unlock()
+	for _, f := range due {
+		f := f
+		err := g.log.read(f.offset, f.offset+1, func(_ uint64, data []byte) error {
+			value, err := g.codec.Decode(data)
+			if err != nil {
+				return fmt.Errorf("decode value %d: %w", f.offset, err)
+			}
+			if !g.deliver(c, f.offset, f.copies+1, value, out, done) {
+				return errReplayStopped
+			}
+			return nil
+		})
+		if errors.Is(err, errReplayStopped) {
+			return 0, false
+		}
+		if err != nil {
+			g.config.handleError(fmt.Errorf("changroup: consumer %q: %w", c.name, err))
+			g.commit(c, f.offset) // the value is skipped, it must not block the cursor
+		}
+	}
+	return wait, true
+}
+
+// ack handles the ack of the copy of the value. Only the first ack of the last copy counts.
+func (g *DurableAckableGroup[T]) ack(c *consumer, offset uint64, copies int, err error) {
+	c.mu.Lock()
+	if c.released || c.pending[offset] != copies {
+		c.mu.Unlock()
+		return // the copy is acked already or the value is received again
+	}
+	delete(c.pending, offset)
+	if err == nil {
+		g.commitLocked(c, offset)
+		c.mu.Unlock()
+		return
+	}
+	exhausted := g.config.maxRedeliveries > 0 && copies > g.config.maxRedeliveries
+	if exhausted {
+		g.commitLocked(c, offset) // the value is skipped, it must not block the cursor
+	} else {
+		c.failed = append(c.failed, redelivery{
+			offset: offset,
+			copies: copies,
+			at:     time.Now().Add(g.config.redeliveryDelay(copies)),
+		})
+		select {
+		case c.retry <- struct{}{}:
+		default: // the consumer is already woken up
+		}
+	}
+	c.mu.Unlock()
+	g.config.handleError(fmt.Errorf("changroup: consumer %q acked value %d with error: %w", c.name, offset, err))
+	if exhausted {
+		g.config.handleError(fmt.Errorf("%w: consumer %q, value %d", ErrRedeliveriesExhausted, c.name, offset))
+	}
+}
+
+// commit marks the value as acked and persists the cursor if it's moved.
+func (g *DurableAckableGroup[T]) commit(c *consumer, offset uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g.commitLocked(c, offset)
+}
+
+// commitLocked is like commit, but must be called under c.mu.
+func (g *DurableAckableGroup[T]) commitLocked(c *consumer, offset uint64) {
+	if c.released || offset < c.cursor {
+		return
+	}
+	if offset > c.cursor {
+		c.acked[offset] = struct{}{}
+		return
+	}
+	c.cursor++
+	for {
+		if _, ok := c.acked[c.cursor]; !ok {
+			break
+		}
+		delete(c.acked, c.cursor)
+		c.cursor++
+	}
+	if err := g.cursors.store(c.name, c.cursor); err != nil {
+		g.config.handleError(err)
+		return
+	}
+	if err := g.trim(); err != nil {
+		g.config.handleError(err)
+	}
+}
+
+// trim deletes segments of the log which are acked by all consumers.
+func (g *DurableAckableGroup[T]) trim() error {
+	g.mu.Lock() // cursors of new consumers are stored under the lock too
+	defer g.mu.Unlock()
+	offset, ok := g.cursors.min()
+	if !ok {
+		return nil
+	}
+	return g.log.deleteBefore(offset)
+}
+
+// Send appends the value to the log. Consumers receive it asynchronously, so Send doesn't wait for them.
+//
+// It returns an error if the value can't be encoded or written.
+func (g *DurableAckableGroup[T]) Send(value T) error {
+	data, err := g.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("changroup: encode value: %w", err)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.log.append(data); err != nil {
+		return err
+	}
+	close(g.appended)
+	g.appended = make(chan struct{})
+	return nil
+}
@@ -0,0 +1,274 @@
+package changroup_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestDurableAckableGroup(t *testing.T) {
+	t.Parallel()
+	t.Run("consumer receives old and new values", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir(), changroup.WithSegmentSize[int](32))
+		require.NoError(t, group.Send(0))
+		require.NoError(t, group.Send(1))
+		ch, release, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		defer release()
+		for i := 0; i < 10; i++ {
+			if i >= 2 {
+				require.NoError(t, group.Send(i))
+			}
+			v := waitChan(t, ch)
+			require.Equal(t, i, v.Value)
+			v.Ack(nil)
+		}
+	})
+	t.Run("consumer resumes from the first not acked value after restart", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableAckableGroup(t, dir)
+		for i := 0; i < 4; i++ {
+			require.NoError(t, group.Send(i))
+		}
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		values := make([]changroup.Ackable[int], 4)
+		for i := range values {
+			values[i] = waitChan(t, ch)
+		}
+		values[0].Ack(nil)
+		values[2].Ack(nil)
+		require.NoError(t, group.Close())
+		values[1].Ack(nil) // is ignored after release
+
+		group = newDurableAckableGroup(t, dir)
+		ch, _, err = group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Equal(t, 1, waitChan(t, ch).Value)
+		require.Equal(t, 2, waitChan(t, ch).Value)
+		require.Equal(t, 3, waitChan(t, ch).Value)
+	})
+	t.Run("consumers are independent", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir())
+		require.NoError(t, group.Send(0))
+		require.NoError(t, group.Send(1))
+		ch1, release1, err := group.AcquireDurable("first")
+		require.NoError(t, err)
+		waitChan(t, ch1).Ack(nil)
+		release1()
+		assertChanClosed(t, ch1)
+		ch2, _, err := group.AcquireDurable("second")
+		require.NoError(t, err)
+		require.Equal(t, 0, waitChan(t, ch2).Value)
+		ch1, _, err = group.AcquireDurable("first")
+		require.NoError(t, err)
+		require.Equal(t, 1, waitChan(t, ch1).Value)
+	})
+	t.Run("consumer can't be acquired twice", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir())
+		require.NoError(t, group.Send(0))
+		ch, release, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		_, _, err = group.AcquireDurable("consumer")
+		require.True(t, errors.Is(err, changroup.ErrConsumerAcquired))
+		require.Equal(t, 0, waitChan(t, ch).Value)
+		release()
+		release()
+		ch, _, err = group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Equal(t, 0, waitChan(t, ch).Value) // not acked value is received again
+	})
+	t.Run("invalid consumer name", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir())
+		for _, name := range []string{"", ".", "..", ".hidden", "a/b", `a\b`, "a b", "тест"} {
+			_, _, err := group.AcquireDurable(name)
+			require.True(t, errors.Is(err, changroup.ErrInvalidConsumerName), name)
+		}
+		_, _, err := group.AcquireDurable("Valid-name_1.0")
+		require.NoError(t, err)
+	})
+	t.Run("value acked with error is received again", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		errs := make(chan error, 1)
+		group := newDurableAckableGroup(t, dir, changroup.WithErrorHandler[int](func(err error) { errs <- err }))
+		require.NoError(t, group.Send(0))
+		require.NoError(t, group.Send(1))
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		errTest := errors.New("test")
+		v0 := waitChan(t, ch)
+		v1 := waitChan(t, ch)
+		v0.Ack(errTest)
+		require.True(t, errors.Is(waitChan(t, errs), errTest))
+		v0 = waitChan(t, ch)
+		require.Equal(t, 0, v0.Value)
+		v1.Ack(nil)
+		v0.Ack(nil)
+		require.NoError(t, group.Close())
+
+		group = newDurableAckableGroup(t, dir)
+		require.NoError(t, group.Send(2))
+		ch, _, err = group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Equal(t, 2, waitChan(t, ch).Value)
+	})
+	t.Run("value acked with error is received again after restart", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableAckableGroup(t, dir, changroup.WithErrorHandler[int](func(error) {}))
+		require.NoError(t, group.Send(0))
+		require.NoError(t, group.Send(1))
+		ch, release, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		v0 := waitChan(t, ch)
+		v1 := waitChan(t, ch)
+		v0.Ack(errors.New("test"))
+		v1.Ack(nil)
+		release()
+		require.NoError(t, group.Close())
+
+		group = newDurableAckableGroup(t, dir)
+		ch, _, err = group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Equal(t, 0, waitChan(t, ch).Value)
+		require.Equal(t, 1, waitChan(t, ch).Value) // it's acked, but after not acked value
+	})
+	t.Run("repeated ack is ignored", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir(), changroup.WithErrorHandler[int](func(error) {}),
+			changroup.WithRedelivery[int](0, 0, 0))
+		require.NoError(t, group.Send(0))
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		errTest := errors.New("test")
+		v0 := waitChan(t, ch)
+		v0.Ack(errTest)
+		v0.Ack(errTest)
+		again := waitChan(t, ch)
+		require.Equal(t, 0, again.Value)
+		v0.Ack(errTest) // the value is received again, the old copy is ignored
+		again.Ack(nil)
+		again.Ack(errTest)
+		require.NoError(t, group.Send(1))
+		require.Equal(t, 1, waitChan(t, ch).Value)
+	})
+	t.Run("redelivery is delayed", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir(), changroup.WithErrorHandler[int](func(error) {}),
+			changroup.WithRedelivery[int](time.Hour, time.Hour, 0))
+		require.NoError(t, group.Send(0))
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		waitChan(t, ch).Ack(errors.New("test"))
+		require.NoError(t, group.Send(1))
+		require.Equal(t, 1, waitChan(t, ch).Value)
+		assertChanBlocked(t, ch)
+	})
+	t.Run("value is skipped after all redeliveries", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		errs := make(chan error, 3)
+		group := newDurableAckableGroup(t, dir, changroup.WithErrorHandler[int](func(err error) { errs <- err }),
+			changroup.WithRedelivery[int](0, 0, 1))
+		require.NoError(t, group.Send(0))
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		errTest := errors.New("test")
+		waitChan(t, ch).Ack(errTest)
+		require.True(t, errors.Is(waitChan(t, errs), errTest))
+		waitChan(t, ch).Ack(errTest)
+		require.True(t, errors.Is(waitChan(t, errs), errTest))
+		require.True(t, errors.Is(waitChan(t, errs), changroup.ErrRedeliveriesExhausted))
+		require.NoError(t, group.Send(1))
+		require.Equal(t, 1, waitChan(t, ch).Value)
+		require.NoError(t, group.Close())
+
+		group = newDurableAckableGroup(t, dir)
+		ch, _, err = group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Equal(t, 1, waitChan(t, ch).Value) // the cursor is moved past the skipped value
+	})
+	t.Run("consumer can be acquired again after read error", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		errs := make(chan error, 10)
+		group := newDurableAckableGroup(t, dir, changroup.WithErrorHandler[int](func(err error) { errs <- err }),
+			changroup.WithSegmentSize[int](1))
+		require.NoError(t, group.Send(0))
+		require.NoError(t, group.Send(1))
+		require.NoError(t, os.Remove(filepath.Join(dir, "00000000000000000000.wal")))
+		_, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.Error(t, waitChan(t, errs))
+		waitCondition(t, func() bool {
+			_, _, err := group.AcquireDurable("consumer")
+			return err == nil
+		})
+	})
+	t.Run("segments acked by all consumers are deleted", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableAckableGroup(t, dir, changroup.WithSegmentSize[int](1))
+		ch1, _, err := group.AcquireDurable("consumer1")
+		require.NoError(t, err)
+		_, release2, err := group.AcquireDurable("consumer2")
+		require.NoError(t, err)
+		release2() // the consumer still holds the log
+		for i := 0; i < 3; i++ {
+			require.NoError(t, group.Send(i))
+			waitChan(t, ch1).Ack(nil)
+		}
+		segments := func() int {
+			segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+			require.NoError(t, err)
+			return len(segments)
+		}
+		require.Equal(t, 3, segments())
+		ch2, _, err := group.AcquireDurable("consumer2")
+		require.NoError(t, err)
+		waitChan(t, ch2).Ack(nil)
+		waitChan(t, ch2).Ack(nil)
+		waitCondition(t, func() bool { return segments() == 1 })
+		require.NoError(t, group.Send(3))
+		require.Equal(t, 2, waitChan(t, ch2).Value)
+
+		ch3, _, err := group.AcquireDurable("consumer3")
+		require.NoError(t, err)
+		require.Equal(t, 2, waitChan(t, ch3).Value) // a new consumer receives values which are not deleted
+	})
+	t.Run("Close releases channels", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableAckableGroup(t, t.TempDir())
+		ch, _, err := group.AcquireDurable("consumer")
+		require.NoError(t, err)
+		require.NoError(t, group.Close())
+		require.NoError(t, group.Close())
+		assertChanClosed(t, ch)
+		require.Equal(t, changroup.ErrClosed, group.Send(0))
+		_, _, err = group.AcquireDurable("consumer")
+		require.Equal(t, changroup.ErrClosed, err)
+	})
+}
+
+func newDurableAckableGroup(
+	t *testing.T, dir string, options ...changroup.DurableGroupOption[int],
+) *changroup.DurableAckableGroup[int] {
+	t.Helper()
+	group, err := changroup.NewDurableAckableGroup[int](dir, intCodec{}, options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, group.Close()) })
+	return group
+}
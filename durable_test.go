@@ -0,0 +1,273 @@
+package changroup_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestDurableGroup(t *testing.T) {
+	t.Parallel()
+	t.Run("sends like Group", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir())
+		ch1, _ := group.Acquire()
+		ch2, release := group.Acquire()
+		release()
+		go func() {
+			assert.NoError(t, group.Send(1))
+		}()
+		require.Equal(t, 1, waitChan(t, ch1))
+		assertChanClosed(t, ch2)
+	})
+	t.Run("replays persisted values after restart", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableGroup(t, dir)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, group.Send(i))
+		}
+		require.NoError(t, group.Close())
+
+		group = newDurableGroup(t, dir)
+		ch, release := group.AcquireReplay()
+		defer release()
+		for i := 0; i < 3; i++ {
+			require.Equal(t, i, waitChan(t, ch))
+		}
+		go func() {
+			assert.NoError(t, group.Send(3))
+		}()
+		require.Equal(t, 3, waitChan(t, ch))
+	})
+	t.Run("Acquire receives only new values", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir())
+		require.NoError(t, group.Send(1))
+		ch, _ := group.Acquire()
+		go func() {
+			assert.NoError(t, group.Send(2))
+		}()
+		require.Equal(t, 2, waitChan(t, ch))
+	})
+	t.Run("no value is missed or duplicated on switch to live", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir(), changroup.WithFsync[int](changroup.FsyncNever()))
+		const n = 100
+		go func() {
+			for i := 0; i < n; i++ {
+				assert.NoError(t, group.Send(i))
+			}
+		}()
+		time.Sleep(time.Millisecond)
+		ch, release := group.AcquireReplay()
+		defer release()
+		for i := 0; i < n; i++ {
+			require.Equal(t, i, waitChan(t, ch))
+		}
+	})
+	t.Run("slow channel doesn't block AcquireReplay", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir())
+		_, releaseSlow := group.Acquire()
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			assert.NoError(t, group.Send(1))
+		}()
+		waitCondition(t, func() bool {
+			ch, release := group.AcquireReplay() // the value is replayed from the log once it's appended
+			defer release()
+			select {
+			case v := <-ch:
+				return v == 1
+			case <-time.After(10 * time.Millisecond):
+				return false
+			}
+		})
+		ch, release := group.AcquireReplay()
+		defer release()
+		require.Equal(t, 1, waitChan(t, ch))
+		assertChanBlocked(t, sent)
+		releaseSlow()
+		waitChan(t, sent)
+		require.NoError(t, group.Send(2))
+		require.Equal(t, 2, waitChan(t, ch)) // the value which was being sent is not duplicated
+	})
+	t.Run("values are kept in several segments", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableGroup(t, dir, changroup.WithSegmentSize[int](32))
+		const n = 10
+		for i := 0; i < n; i++ {
+			require.NoError(t, group.Send(i))
+		}
+		segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+		require.NoError(t, err)
+		require.Greater(t, len(segments), 1)
+		ch, release := group.AcquireReplay()
+		defer release()
+		for i := 0; i < n; i++ {
+			require.Equal(t, i, waitChan(t, ch))
+		}
+	})
+	t.Run("old segments are deleted", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableGroup(t, dir, changroup.WithSegmentSize[int](1), changroup.WithLogRetention[int](30, 0))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, group.Send(i))
+		}
+		segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+		require.NoError(t, err)
+		require.Len(t, segments, 3) // each value is 9 bytes
+		ch, release := group.AcquireReplay()
+		defer release()
+		for i := 7; i < 10; i++ {
+			require.Equal(t, i, waitChan(t, ch))
+		}
+	})
+	t.Run("torn value is discarded on restart", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableGroup(t, dir)
+		require.NoError(t, group.Send(1))
+		require.NoError(t, group.Close())
+		segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = file.Write([]byte{5, 0, 0, 0, 1, 2})
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		group = newDurableGroup(t, dir)
+		require.NoError(t, group.Send(2))
+		ch, release := group.AcquireReplay()
+		defer release()
+		require.Equal(t, 1, waitChan(t, ch))
+		require.Equal(t, 2, waitChan(t, ch))
+	})
+	t.Run("decode errors are reported and skipped", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		group := newDurableGroup(t, dir)
+		require.NoError(t, group.Send(1))
+		require.NoError(t, group.Send(-1))
+		require.NoError(t, group.Send(2))
+		require.NoError(t, group.Close())
+
+		errs := make(chan error, 1)
+		group, err := changroup.NewDurableGroup[int](dir, positiveCodec{},
+			changroup.WithErrorHandler[int](func(err error) { errs <- err }))
+		require.NoError(t, err)
+		defer group.Close()
+		ch, release := group.AcquireReplay()
+		defer release()
+		require.Equal(t, 1, waitChan(t, ch))
+		require.Equal(t, 2, waitChan(t, ch))
+		require.True(t, errors.Is(waitChan(t, errs), errNegative))
+	})
+	t.Run("encode error is returned", func(t *testing.T) {
+		t.Parallel()
+		group, err := changroup.NewDurableGroup[int](t.TempDir(), positiveCodec{})
+		require.NoError(t, err)
+		defer group.Close()
+		require.True(t, errors.Is(group.Send(-1), errNegative))
+	})
+	t.Run("Close releases channels", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir())
+		ch1, _ := group.Acquire()
+		ch2, _ := group.AcquireReplay()
+		require.NoError(t, group.Close())
+		require.NoError(t, group.Close())
+		assertChanClosed(t, ch1)
+		assertChanClosed(t, ch2)
+		require.Equal(t, changroup.ErrClosed, group.Send(1))
+	})
+	t.Run("Close unblocks Send", func(t *testing.T) {
+		t.Parallel()
+		group := newDurableGroup(t, t.TempDir())
+		_, _ = group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, group.Send(1))
+		}()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, done)
+		require.NoError(t, group.Close())
+		waitChan(t, done)
+	})
+	t.Run("fsync policies", func(t *testing.T) {
+		t.Parallel()
+		for name, policy := range map[string]changroup.FsyncPolicy{
+			"always": changroup.FsyncAlways(),
+			"every":  changroup.FsyncEvery(time.Millisecond),
+			"never":  changroup.FsyncNever(),
+		} {
+			policy := policy
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				dir := t.TempDir()
+				group := newDurableGroup(t, dir, changroup.WithFsync[int](policy))
+				require.NoError(t, group.Send(1))
+				time.Sleep(10 * time.Millisecond)
+				require.NoError(t, group.Close())
+				group = newDurableGroup(t, dir)
+				ch, _ := group.AcquireReplay()
+				require.Equal(t, 1, waitChan(t, ch))
+			})
+		}
+	})
+}
+
+func newDurableGroup(
+	t *testing.T, dir string, options ...changroup.DurableGroupOption[int],
+) *changroup.DurableGroup[int] {
+	t.Helper()
+	group, err := changroup.NewDurableGroup[int](dir, intCodec{}, options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, group.Close()) })
+	return group
+}
+
+type intCodec struct{}
+
+func (intCodec) Encode(value int) ([]byte, error) {
+	return []byte(strconv.Itoa(value)), nil
+}
+
+func (intCodec) Decode(data []byte) (int, error) {
+	return strconv.Atoi(string(data)) //nolint:wrapcheck // test codec
+}
+
+var errNegative = errors.New("negative")
+
+// positiveCodec is like intCodec, but fails for negative values.
+type positiveCodec struct{}
+
+func (positiveCodec) Encode(value int) ([]byte, error) {
+	if value < 0 {
+		return nil, errNegative
+	}
+	return intCodec{}.Encode(value)
+}
+
+func (positiveCodec) Decode(data []byte) (int, error) {
+	value, err := intCodec{}.Decode(data)
+	if err == nil && value < 0 {
+		return 0, errNegative
+	}
+	return value, err
+}
@@ -102,8 +102,8 @@ func ExampleAckableGroup() {
 		defer group.ReleaseAll() // close all channels and remove from group
 
 		for i := 0; i < 100; i++ {
-			group.Send(changroup.NewAckable(i, func() {
-				fmt.Println("publisher received acks from all subscribers for i =", i)
+			group.Send(changroup.NewAckable(i, func(err error) {
+				fmt.Println("publisher received acks from all subscribers for i =", i, "err =", err)
 			}))
 			time.Sleep(1 * time.Second)
 		}
@@ -113,7 +113,7 @@ func ExampleAckableGroup() {
 		defer wg.Done()
 		for a := range ch1 {
 			fmt.Println("subscriber 1 received", a.Value)
-			a.Ack() // value is processed
+			a.Ack(nil) // value is processed successfully
 		}
 		fmt.Println("ch1 is closed because group.ReleaseAll() is called")
 	}()
@@ -122,7 +122,7 @@ func ExampleAckableGroup() {
 		defer wg.Done()
 		for a := range ch2 {
 			fmt.Println("subscriber 2 received", a.Value)
-			a.Ack() // value is processed
+			a.Ack(nil) // value is processed successfully
 		}
 		fmt.Println("ch2 is closed because group.ReleaseAll() is called")
 	}()
@@ -0,0 +1,65 @@
+package changroup
+
+import "sync"
+
+// fifo is an unbounded queue drained by a single goroutine.
+// Fields are accessed by callers under mu.
+type fifo[T any] struct {
+	mu       sync.Mutex
+	items    []T
+	head     int  // index of the first item, popped items before it are zeroed
+	draining bool // drain goroutine is running
+}
+
+func newFIFO[T any]() fifo[T] {
+	return fifo[T]{
+		mu:       sync.Mutex{},
+		items:    nil,
+		head:     0,
+		draining: false,
+	}
+}
+
+// idle returns true if the queue is empty and there is no drain goroutine. It must be called under lock.
+func (q *fifo[T]) idle() bool {
+	return q.head == len(q.items) && !q.draining
+}
+
+// pop removes the first item. It returns false if the queue is empty.
+func (q *fifo[T]) pop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.popLocked()
+}
+
+// popOrStop is like pop, but also marks draining as stopped if the queue is empty.
+// It should be called only by drain goroutine.
+func (q *fifo[T]) popOrStop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.popLocked()
+	if !ok {
+		q.draining = false
+	}
+	return item, ok
+}
+
+func (q *fifo[T]) popLocked() (T, bool) {
+	var zero T
+	if q.head == len(q.items) {
+		return zero, false
+	}
+	item := q.items[q.head]
+	q.items[q.head] = zero
+	q.head++
+	// reuse the array to not allocate on each append, but don't let popped items occupy most of it
+	if q.head > len(q.items)/2 {
+		n := copy(q.items, q.items[q.head:])
+		for i := n; i < len(q.items); i++ {
+			q.items[i] = zero
+		}
+		q.items = q.items[:n]
+		q.head = 0
+	}
+	return item, true
+}
@@ -0,0 +1,49 @@
+package changroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIFO(t *testing.T) {
+	t.Parallel()
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		q := newFIFO[int]()
+		assert.True(t, q.idle())
+		_, ok := q.pop()
+		assert.False(t, ok)
+	})
+	t.Run("preserves order while items are added and popped", func(t *testing.T) {
+		t.Parallel()
+		q := newFIFO[int]()
+		next := 0
+		for i := 0; i < 100; i++ {
+			q.items = append(q.items, 2*i, 2*i+1)
+			item, ok := q.pop()
+			assert.True(t, ok)
+			assert.Equal(t, next, item)
+			next++
+		}
+		for ; next < 200; next++ {
+			item, ok := q.pop()
+			assert.True(t, ok)
+			assert.Equal(t, next, item)
+		}
+		assert.True(t, q.idle())
+	})
+	t.Run("reuses array after it becomes empty", func(t *testing.T) {
+		t.Parallel()
+		q := newFIFO[int]()
+		q.items = append(q.items, 1, 2, 3)
+		capacity := cap(q.items)
+		for i := 0; i < 3; i++ {
+			q.pop()
+		}
+		q.items = append(q.items, 4)
+		assert.Equal(t, capacity, cap(q.items))
+		item, _ := q.pop()
+		assert.Equal(t, 4, item)
+	})
+}
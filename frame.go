@@ -0,0 +1,132 @@
+package changroup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Frame types of the protocol used by [RemoteServer] and [RemoteClient].
+// Each frame is a type byte, big-endian uint32 payload length and the payload.
+const (
+	frameHello   byte = iota + 1 // client → server: protocol version and 1 if the subscription is ackable
+	frameValue                   // server → client: encoded value
+	frameAckable                 // server → client: big-endian uint64 id and encoded value
+	frameAck                     // client → server: big-endian uint64 id and error message, empty if nil
+	framePing                    // both ways: heartbeat
+	frameError                   // server → client: reason, the connection is closed after it
+)
+
+const (
+	remoteVersion    = 1
+	frameHeaderSize  = 5
+	frameMaxPayload  = 1 << 30
+	frameIDSize      = 8
+	missedHeartbeats = 3 // the peer is considered dead after this number of missed heartbeats
+)
+
+var (
+	errFrameTooLarge   = errors.New("changroup: frame is too large")
+	errUnexpectedFrame = errors.New("changroup: unexpected frame")
+)
+
+// remoteConn reads and writes frames.
+//
+// Writes don't have a deadline, because a peer which reads slowly is alive. A write to a dead peer is unblocked
+// by closing the connection once reading fails, see [remoteConn.read].
+type remoteConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // serializes writes
+}
+
+func newRemoteConn(conn net.Conn) *remoteConn {
+	return &remoteConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		mu:   sync.Mutex{},
+	}
+}
+
+// write sends the frame with the payload made of parts.
+// It's safe for concurrent use.
+func (c *remoteConn) write(kind byte, parts ...[]byte) error {
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+size)
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[1:], uint32(size))
+	for _, part := range parts {
+		buf = append(buf, part...)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("changroup: write frame: %w", err)
+	}
+	return nil
+}
+
+// read receives the next frame. It fails if the frame is not received within timeout.
+// It must not be called concurrently.
+func (c *remoteConn) read(timeout time.Duration) (byte, []byte, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, nil, fmt.Errorf("changroup: read frame: %w", err)
+	}
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, fmt.Errorf("changroup: read frame: %w", err)
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > frameMaxPayload {
+		return 0, nil, errFrameTooLarge
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("changroup: read frame: %w", err)
+	}
+	return header[0], payload, nil
+}
+
+// heartbeat sends ping frames periodically until stop is closed or write fails.
+func (c *remoteConn) heartbeat(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(framePing); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// closedConnError returns true if the error is caused by closed connection, so it's not worth reporting.
+func closedConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// encodeID returns id as payload part.
+func encodeID(id uint64) []byte {
+	buf := make([]byte, frameIDSize)
+	binary.BigEndian.PutUint64(buf, id)
+	return buf
+}
+
+// decodeID splits payload to id and the rest.
+func decodeID(payload []byte) (uint64, []byte, error) {
+	if len(payload) < frameIDSize {
+		return 0, nil, errUnexpectedFrame
+	}
+	return binary.BigEndian.Uint64(payload), payload[frameIDSize:], nil
+}
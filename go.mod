@@ -1,6 +1,6 @@
 module github.com/maratori/changroup
 
-go 1.19 // minimal supported version 1.19, tested all versions up to 1.26
+go 1.20 // minimal supported version 1.20, tested all versions up to 1.26
 
 require github.com/stretchr/testify v1.4.0
 
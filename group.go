@@ -2,40 +2,87 @@ package changroup
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // ReleaseFunc is called to remove channel from group and close it.
 type ReleaseFunc func()
 
-type channel[T any] struct {
-	ch      chan T
-	done    chan struct{}
-	send    sync.WaitGroup
-	release ReleaseFunc
+// GroupOption configures [Group], see [NewGroup].
+type GroupOption[T any] func(*groupConfig[T])
+
+type groupConfig[T any] struct {
+	dispatcher   bool
+	workers      int
+	budget       int
+	budgetPolicy BudgetPolicy
+}
+
+// WithDispatcher makes [Group] deliver values with a long-lived dispatcher goroutine per channel.
+//
+// By default, [Group.Send] and [Group.SendAsync] start a goroutine per value per channel which is not ready
+// to receive. It's cheap if subscribers read fast, but may create a lot of goroutines if they are slow.
+// With dispatcher, each channel has an unbounded queue, values are put there and sent by the dispatcher
+// goroutine of the channel. The number of goroutines is always equal to the number of acquired channels.
+// [Group.SendAsync] preserves the order of values in this mode.
+func WithDispatcher[T any]() GroupOption[T] {
+	return func(c *groupConfig[T]) {
+		c.dispatcher = true
+	}
 }
 
+// WithParallelFanOut makes [Group] split acquired channels into shards and send to them by up to workers
+// goroutines in parallel. It's useful if there are thousands of channels.
+//
+// Each send waits until all shards are processed, so every channel still receives values in the order of sends.
+// Small groups are served by the calling goroutine only.
+func WithParallelFanOut[T any](workers int) GroupOption[T] {
+	return func(c *groupConfig[T]) {
+		c.workers = workers
+	}
+}
+
+// minShardSize is the minimal number of channels processed by a worker, see [WithParallelFanOut].
+const minShardSize = 256
+
 // Group provides pub-sub model working with channels.
 //
 // Each acquired channel will receive a copy of a value provided to [Group.Send].
 type Group[T any] struct {
-	channels *list[*channel[T]]
+	channels *registry[*channel[T]]
+	ops      *opPool[T]
+	budget   chan struct{} // tokens of goroutines started by SendAsync, nil if unlimited, see WithAsyncBudget
+	dropped  atomic.Uint64
+	config   groupConfig[T]
 }
 
-func NewGroup[T any]() *Group[T] {
-	return &Group[T]{
-		channels: newList[*channel[T]](),
+func NewGroup[T any](options ...GroupOption[T]) *Group[T] {
+	g := &Group[T]{
+		channels: newRegistry[*channel[T]](),
+		ops:      newOpPool[T](),
+		budget:   nil,
+		dropped:  atomic.Uint64{},
+		config: groupConfig[T]{
+			dispatcher:   false,
+			workers:      1,
+			budget:       0,
+			budgetPolicy: BudgetBlock,
+		},
+	}
+	for _, option := range options {
+		option(&g.config)
 	}
+	if g.config.budget > 0 {
+		g.budget = make(chan struct{}, g.config.budget)
+	}
+	return g
 }
 
 // ReleaseAll releases all acquired channels and closes them.
 // It's safe to call [Group.ReleaseAll] several times as well as in parallel with [ReleaseFunc].
 func (g *Group[T]) ReleaseAll() {
-	var all []*channel[T]
-	g.channels.ForEach(func(ch *channel[T]) {
-		all = append(all, ch)
-	})
-	for _, ch := range all {
-		ch.release() // there will be deadlock if call it inside ForEach.
+	for _, ch := range g.channels.RemoveAll() {
+		ch.release()
 	}
 }
 
@@ -45,24 +92,21 @@ func (g *Group[T]) ReleaseAll() {
 // It should be called to remove the channel from the group and close it.
 // It's safe to call [ReleaseFunc] several times as well as in parallel with [Group.ReleaseAll].
 func (g *Group[T]) Acquire() (<-chan T, ReleaseFunc) {
-	ch := g.channels.Append(&channel[T]{
-		ch:      make(chan T),
-		done:    make(chan struct{}),
-		send:    sync.WaitGroup{},
-		release: nil, // is filled below
-	})
+	ch := newChannel[T]()
+	if g.config.dispatcher {
+		ch.startDispatcher()
+	}
 
 	once := sync.Once{}
-	ch.elem.release = func() {
+	ch.release = func() {
 		once.Do(func() {
-			ch.Delete()
-			close(ch.elem.done)
-			ch.elem.send.Wait()
-			close(ch.elem.ch)
+			g.channels.Remove(ch)
+			ch.close()
 		})
 	}
 
-	return ch.elem.ch, ch.elem.release
+	g.channels.Add(ch)
+	return ch.ch, ch.release
 }
 
 // Send sends a value to each acquired channel.
@@ -72,43 +116,128 @@ func (g *Group[T]) Acquire() (<-chan T, ReleaseFunc) {
 //
 // It waits for all channels to receive the value or to be released.
 func (g *Group[T]) Send(value T) {
+	o := g.ops.get(opSend)
+	o.value = value
+	g.forEach(o)
+	o.wg.Wait()
+	g.ops.put(o)
+}
+
+// SendMany sends values to each acquired channel like [Group.Send] does for each of them,
+// but with less overhead per value.
+//
+// Each channel receives all values one after another, values of other sends are not interleaved with them.
+// A channel acquired during [Group.SendMany] receives either all values or none of them.
+//
+// It waits for all channels to receive the values or to be released.
+func (g *Group[T]) SendMany(values ...T) {
+	if len(values) == 0 {
+		return
+	}
+	o := g.ops.get(opSendMany)
+	o.values = values
+	g.forEach(o)
+	o.wg.Wait()
+	g.ops.put(o)
+}
+
+// SendAsync sends a value to each acquired channel, but unlike [Group.Send] doesn't block.
+// Also, it doesn't preserve the order of values! Use [Group.SendAsyncOrdered] if the order matters.
+// It starts a goroutine per channel which is not ready to receive, see [WithAsyncBudget] to limit them.
+func (g *Group[T]) SendAsync(value T) {
+	if g.config.dispatcher {
+		g.SendAsyncOrdered(value)
+		return
+	}
+	o := g.ops.get(opSendAsync)
+	o.value = value
+	g.forEach(o)
+	g.ops.put(o)
+}
+
+// SendAsyncOrdered sends a value to each acquired channel, but unlike [Group.Send] doesn't block.
+//
+// Unlike [Group.SendAsync] it guarantees that all channels receive the values in the same order
+// as [Group.SendAsyncOrdered] calls. Each channel has an unbounded queue drained by a single goroutine.
+// The order is not guaranteed relative to values sent by [Group.Send] or [Group.SendAsync].
+func (g *Group[T]) SendAsyncOrdered(value T) {
+	o := g.ops.get(opSendAsyncOrdered)
+	o.value = value
+	g.forEach(o)
+	g.ops.put(o)
+}
+
+// sendTo sends the value(s) of the operation to the channel. It must be called under [channel.lock].
+// It returns true if the value is not sent yet, because it should wait for the budget, see [Group.waitBudget].
+func (g *Group[T]) sendTo(ch *channel[T], o *op[T]) bool {
+	switch o.kind {
+	case opSend:
+		if g.config.dispatcher {
+			ch.push(&o.wg, o.value)
+		} else {
+			ch.deliver(o.value, &o.wg)
+		}
+	case opSendMany:
+		if g.config.dispatcher {
+			ch.push(&o.wg, o.values...)
+		} else {
+			ch.deliverMany(o.values, &o.wg)
+		}
+	case opSendAsync:
+		if g.budget != nil {
+			return g.sendAsyncBudget(ch, o.value)
+		}
+		ch.deliver(o.value, nil)
+	case opSendAsyncOrdered:
+		if g.config.dispatcher {
+			ch.push(nil, o.value)
+		} else {
+			ch.enqueue(o.value)
+		}
+	}
+	return false
+}
+
+// forEach sends the value(s) of the operation to each acquired channel under [channel.lock].
+// Released channels are skipped. Channels are processed in parallel if [WithParallelFanOut] is used.
+func (g *Group[T]) forEach(o *op[T]) {
+	channels := g.channels.Snapshot()
+	shards := len(channels) / minShardSize
+	if shards > g.config.workers {
+		shards = g.config.workers
+	}
+	if shards <= 1 {
+		g.sendToAll(channels, o)
+		return
+	}
+	size := (len(channels) + shards - 1) / shards
 	wg := sync.WaitGroup{}
-	g.channels.ForEach(func(ch *channel[T]) {
-		// select is an optimisation to not create goroutine if someone reads the channel (should cover 90% cases)
-		select {
-		case ch.ch <- value:
-		default:
-			wg.Add(1)
-			ch.send.Add(1)
-			go func() {
-				defer wg.Done()
-				defer ch.send.Done()
-				select {
-				case ch.ch <- value:
-				case <-ch.done:
-				}
-			}()
+	for start := size; start < len(channels); start += size {
+		end := start + size
+		if end > len(channels) {
+			end = len(channels)
 		}
-	})
+		shard := channels[start:end]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.sendToAll(shard, o)
+		}()
+	}
+	g.sendToAll(channels[:size], o)
 	wg.Wait()
 }
 
-// SendAsync sends a value to each acquired channel, but unlike [Group.Send] doesn't block.
-// Also, it doesn't preserve the order of values!
-func (g *Group[T]) SendAsync(value T) {
-	g.channels.ForEach(func(ch *channel[T]) {
-		// select is an optimisation to not create goroutine if someone reads the channel (should cover 90% cases)
-		select {
-		case ch.ch <- value:
-		default:
-			ch.send.Add(1)
-			go func() {
-				defer ch.send.Done()
-				select {
-				case ch.ch <- value:
-				case <-ch.done:
-				}
-			}()
+// sendToAll sends the value(s) of the operation to each not released channel under [channel.lock].
+func (g *Group[T]) sendToAll(channels []*channel[T], o *op[T]) {
+	for _, ch := range channels {
+		if !ch.lock() {
+			continue
 		}
-	})
+		wait := g.sendTo(ch, o)
+		ch.unlock()
+		if wait {
+			g.waitBudget(ch, o.value)
+		}
+	}
 }
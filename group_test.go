@@ -6,16 +6,36 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/maratori/changroup"
 )
 
-func TestGroup(t *testing.T) { //nolint:gocognit // yeah
+func TestGroup(t *testing.T) {
 	t.Parallel()
+	for name, newGroup := range groupEngines() {
+		newGroup := newGroup
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testGroup(t, newGroup)
+		})
+	}
+}
+
+func groupEngines() map[string]func() *changroup.Group[int] {
+	return map[string]func() *changroup.Group[int]{
+		"default":    func() *changroup.Group[int] { return changroup.NewGroup[int]() },
+		"dispatcher": func() *changroup.Group[int] { return changroup.NewGroup(changroup.WithDispatcher[int]()) },
+		// shards are used only for big groups, they are tested in TestGroupWithParallelFanOut
+		"parallel": func() *changroup.Group[int] { return changroup.NewGroup(changroup.WithParallelFanOut[int](4)) },
+	}
+}
+
+func testGroup(t *testing.T, newGroup func() *changroup.Group[int]) { //nolint:gocognit // yeah
 	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		assertDoesNotStuck(t, group.Send, 1)
 		assertDoesNotStuck(t, group.Send, 2)
 		assertDoesNotStuck(t, group.Send, 3)
@@ -25,21 +45,21 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 	})
 	t.Run("release closes channel", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch, release := group.Acquire()
 		release()
 		assertChanClosed(t, ch)
 	})
 	t.Run("release can be called twice", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		_, release := group.Acquire()
 		release()
 		release()
 	})
 	t.Run("ReleaseAll closes all channels", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch1, _ := group.Acquire()
 		ch2, _ := group.Acquire()
 		group.ReleaseAll()
@@ -48,7 +68,7 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 	})
 	t.Run("ReleaseAll can be called twice and in parallel with ReleaseFunc", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch1, release1 := group.Acquire()
 		ch2, release2 := group.Acquire()
 
@@ -77,7 +97,7 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 	})
 	t.Run("doesn't send to released channel", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch1, _ := group.Acquire()
 		ch2, release := group.Acquire()
 		release()
@@ -90,7 +110,7 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 	})
 	t.Run("Send blocks", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch, _ := group.Acquire()
 		done1 := make(chan struct{})
 		done2 := make(chan struct{})
@@ -112,9 +132,28 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 		require.Equal(t, 2, waitChan(t, ch))
 		waitChan(t, done2)
 	})
+	t.Run("Acquire and release don't wait for blocked Send", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch1, _ := group.Acquire()
+		ch2, release2 := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.Send(1)
+		}()
+		ch3, release3 := group.Acquire()
+		release2()
+		release3()
+		assertChanClosed(t, ch3)
+		assertChanBlocked(t, done)
+		require.Equal(t, 1, waitChan(t, ch1))
+		waitChan(t, done)
+		assertChanClosed(t, ch2)
+	})
 	t.Run("SendAsync doesn't block", func(t *testing.T) {
 		t.Parallel()
-		group := changroup.NewGroup[int]()
+		group := newGroup()
 		ch1, _ := group.Acquire()
 		ch2, _ := group.Acquire()
 		assertDoesNotStuck(t, group.SendAsync, 1)
@@ -136,13 +175,13 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 			defer mu.Unlock()
 			return time.Duration(r.Int63n(int64(time.Millisecond)))
 		}
-		group := changroup.NewGroup[struct{}]()
+		group := newGroup()
 		done := make(chan struct{})
 		stop := make(chan struct{})
 		go func() {
 			defer func() { done <- struct{}{} }()
 			for {
-				group.Send(struct{}{})
+				group.Send(0)
 				select {
 				case <-time.After(randDuration()):
 				case <-stop:
@@ -153,7 +192,18 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 		go func() {
 			defer func() { done <- struct{}{} }()
 			for {
-				group.SendAsync(struct{}{})
+				group.SendAsync(0)
+				select {
+				case <-time.After(randDuration()):
+				case <-stop:
+					return
+				}
+			}
+		}()
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				group.SendAsyncOrdered(0)
 				select {
 				case <-time.After(randDuration()):
 				case <-stop:
@@ -185,7 +235,7 @@ func TestGroup(t *testing.T) { //nolint:gocognit // yeah
 		}
 		time.Sleep(5 * time.Second)
 		close(stop)
-		for i := 0; i < n+2; i++ {
+		for i := 0; i < n+3; i++ {
 			select {
 			case <-done:
 			case <-time.After(5 * time.Second):
@@ -205,6 +255,18 @@ func waitChan[T any](t *testing.T, ch <-chan T) T {
 	}
 }
 
+// waitCondition is like require.Eventually, which may panic in the used version of testify.
+func waitCondition(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			require.Fail(t, "condition is not satisfied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func assertChanClosed[T any](t *testing.T, ch <-chan T) {
 	select {
 	case v, ok := <-ch:
@@ -235,3 +297,297 @@ func assertDoesNotStuck[T any](t *testing.T, fn func(T), value T) {
 	}()
 	waitChan(t, done)
 }
+
+func TestGroupSendAsyncOrdered(t *testing.T) {
+	t.Parallel()
+	for name, newGroup := range groupEngines() {
+		newGroup := newGroup
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testGroupSendAsyncOrdered(t, newGroup)
+		})
+	}
+}
+
+func testGroupSendAsyncOrdered(t *testing.T, newGroup func() *changroup.Group[int]) {
+	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		assertDoesNotStuck(t, group.SendAsyncOrdered, 1)
+	})
+	t.Run("doesn't block and preserves order", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		const n = 100
+		for i := 0; i < n; i++ {
+			assertDoesNotStuck(t, group.SendAsyncOrdered, i)
+		}
+		// ch1 is not blocked even if no one is reading ch2
+		for i := 0; i < n; i++ {
+			require.Equal(t, i, waitChan(t, ch1))
+		}
+		for i := 0; i < n; i++ {
+			require.Equal(t, i, waitChan(t, ch2))
+		}
+	})
+	t.Run("release drops queued values", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch, release := group.Acquire()
+		group.SendAsyncOrdered(1)
+		group.SendAsyncOrdered(2)
+		require.Equal(t, 1, waitChan(t, ch))
+		release()
+		assertChanClosed(t, ch)
+	})
+	t.Run("queue is drained again after it becomes empty", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch, _ := group.Acquire()
+		group.SendAsyncOrdered(1)
+		group.SendAsyncOrdered(2)
+		require.Equal(t, 1, waitChan(t, ch))
+		require.Equal(t, 2, waitChan(t, ch))
+		group.SendAsyncOrdered(3)
+		group.SendAsyncOrdered(4)
+		require.Equal(t, 3, waitChan(t, ch))
+		require.Equal(t, 4, waitChan(t, ch))
+	})
+}
+
+func TestGroupWithDispatcher(t *testing.T) {
+	t.Parallel()
+	t.Run("SendAsync preserves order", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithDispatcher[int]())
+		ch, _ := group.Acquire()
+		const n = 100
+		for i := 0; i < n; i++ {
+			assertDoesNotStuck(t, group.SendAsync, i)
+		}
+		for i := 0; i < n; i++ {
+			require.Equal(t, i, waitChan(t, ch))
+		}
+	})
+	t.Run("release unblocks Send", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithDispatcher[int]())
+		ch, release := group.Acquire()
+		group.SendAsync(1)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.Send(2)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, done)
+		release()
+		waitChan(t, done)
+		assertChanClosed(t, ch)
+	})
+}
+
+func TestGroupSendMany(t *testing.T) {
+	t.Parallel()
+	for name, newGroup := range groupEngines() {
+		newGroup := newGroup
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			testGroupSendMany(t, newGroup)
+		})
+	}
+}
+
+func testGroupSendMany(t *testing.T, newGroup func() *changroup.Group[int]) {
+	t.Run("doesn't stuck if not acquired", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		assertDoesNotStuck(t, func(values []int) { group.SendMany(values...) }, []int{1, 2, 3})
+		assertDoesNotStuck(t, func(values []int) { group.SendMany(values...) }, nil)
+	})
+	t.Run("each channel receives all values in order", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendMany(1, 2, 3)
+		}()
+		for i := 1; i <= 3; i++ {
+			require.Equal(t, i, waitChan(t, ch1))
+		}
+		assertChanBlocked(t, done)
+		for i := 1; i <= 3; i++ {
+			require.Equal(t, i, waitChan(t, ch2))
+		}
+		waitChan(t, done)
+	})
+	t.Run("other sends are not interleaved", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch, _ := group.Acquire()
+		const n = 10
+		values := make([]int, n)
+		for i := range values {
+			values[i] = i
+		}
+		go group.SendMany(values...)
+		go group.SendMany(values...)
+		go group.Send(-1)
+		group.SendAsync(-2)
+		group.SendAsyncOrdered(-3)
+		for received := 0; received < 2*n; {
+			v := waitChan(t, ch)
+			if v < 0 {
+				continue
+			}
+			require.Equal(t, 0, v)
+			for i := 1; i < n; i++ {
+				require.Equal(t, i, waitChan(t, ch))
+			}
+			received += n
+		}
+	})
+	t.Run("channel acquired during SendMany receives nothing", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch1, _ := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendMany(1, 2, 3)
+		}()
+		require.Equal(t, 1, waitChan(t, ch1))
+		ch2, _ := group.Acquire()
+		require.Equal(t, 2, waitChan(t, ch1))
+		require.Equal(t, 3, waitChan(t, ch1))
+		waitChan(t, done)
+		assertChanBlocked(t, ch2)
+	})
+	t.Run("release unblocks SendMany", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		ch, release := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.SendMany(1, 2, 3)
+		}()
+		require.Equal(t, 1, waitChan(t, ch))
+		release()
+		waitChan(t, done)
+		assertChanClosed(t, ch)
+	})
+}
+
+func TestGroupWithParallelFanOut(t *testing.T) {
+	t.Parallel()
+	t.Run("each channel receives values in order", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithParallelFanOut[int](4))
+		const subscribers = 1000
+		const n = 10
+		done := make(chan struct{})
+		for i := 0; i < subscribers; i++ {
+			ch, _ := group.Acquire()
+			go func() {
+				defer func() { done <- struct{}{} }()
+				for i := 0; i < n; i++ {
+					assert.Equal(t, i, <-ch)
+				}
+			}()
+		}
+		for i := 0; i < n; i++ {
+			assertDoesNotStuck(t, group.Send, i)
+		}
+		for i := 0; i < subscribers; i++ {
+			waitChan(t, done)
+		}
+	})
+	t.Run("SendAsyncOrdered preserves order", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithParallelFanOut[int](4))
+		const subscribers = 1000
+		const n = 10
+		channels := make([]<-chan int, 0, subscribers)
+		for i := 0; i < subscribers; i++ {
+			ch, _ := group.Acquire()
+			channels = append(channels, ch)
+		}
+		for i := 0; i < n; i++ {
+			assertDoesNotStuck(t, group.SendAsyncOrdered, i)
+		}
+		for _, ch := range channels {
+			for i := 0; i < n; i++ {
+				require.Equal(t, i, waitChan(t, ch))
+			}
+		}
+	})
+	t.Run("SendMany delivers batch to each shard", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithParallelFanOut[int](4))
+		const subscribers = 1000
+		done := make(chan struct{})
+		for i := 0; i < subscribers; i++ {
+			ch, _ := group.Acquire()
+			go func() {
+				defer func() { done <- struct{}{} }()
+				for i := 1; i <= 3; i++ {
+					assert.Equal(t, i, <-ch)
+				}
+			}()
+		}
+		assertDoesNotStuck(t, func(values []int) { group.SendMany(values...) }, []int{1, 2, 3})
+		for i := 0; i < subscribers; i++ {
+			waitChan(t, done)
+		}
+	})
+	t.Run("released channels are skipped", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithParallelFanOut[int](4))
+		const subscribers = 1000
+		done := make(chan struct{})
+		for i := 0; i < subscribers; i++ {
+			ch, release := group.Acquire()
+			if i%3 == 0 {
+				release()
+				assertChanClosed(t, ch)
+				continue
+			}
+			go func() {
+				defer func() { done <- struct{}{} }()
+				assert.Equal(t, 1, <-ch)
+			}()
+		}
+		assertDoesNotStuck(t, group.Send, 1)
+		for i := 0; i < subscribers-(subscribers+2)/3; i++ {
+			waitChan(t, done)
+		}
+	})
+	t.Run("release unblocks send to the last shard", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup(changroup.WithParallelFanOut[int](4))
+		const subscribers = 1000
+		for i := 0; i < subscribers-1; i++ {
+			ch, _ := group.Acquire()
+			go func() {
+				for range ch { //nolint:revive // just drain
+				}
+			}()
+		}
+		_, release := group.Acquire()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.Send(1)
+		}()
+		assertChanBlocked(t, done)
+		release()
+		waitChan(t, done)
+		group.ReleaseAll()
+	})
+}
@@ -0,0 +1,92 @@
+package changroup
+
+import "time"
+
+const (
+	defaultIdleTimeout = time.Minute
+	defaultPollBuffer  = 1000
+	defaultAckTimeout  = 30 * time.Second
+	defaultMaxBodySize = 1 << 20
+	defaultMaxSends    = 64
+)
+
+// HTTPOption configures HTTP handlers, see [NewSSEHandler], [NewLongPoll] and [NewWebhookHandler].
+type HTTPOption func(*httpConfig)
+
+type httpConfig struct {
+	errorHandler func(error)
+	idleTimeout  time.Duration
+	pollBuffer   int
+	ackTimeout   time.Duration
+	maxBodySize  int64
+	maxSends     int
+}
+
+func newHTTPConfig(options []HTTPOption) httpConfig {
+	c := httpConfig{
+		errorHandler: nil,
+		idleTimeout:  defaultIdleTimeout,
+		pollBuffer:   defaultPollBuffer,
+		ackTimeout:   defaultAckTimeout,
+		maxBodySize:  defaultMaxBodySize,
+		maxSends:     defaultMaxSends,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// WithHTTPErrorHandler sets the function called for errors which can't be returned to the client,
+// e.g. failed encoding of a value after the response is started. By default, such errors are ignored.
+func WithHTTPErrorHandler(handler func(error)) HTTPOption {
+	return func(c *httpConfig) {
+		c.errorHandler = handler
+	}
+}
+
+// WithIdleTimeout sets how long a subscription of [LongPoll] lives without polls. Default is 1 minute.
+func WithIdleTimeout(timeout time.Duration) HTTPOption {
+	return func(c *httpConfig) {
+		c.idleTimeout = timeout
+	}
+}
+
+// WithPollBuffer sets how many values a subscription of [LongPoll] buffers between polls. Default is 1000.
+// The oldest values are dropped if the buffer is full.
+func WithPollBuffer(size int) HTTPOption {
+	return func(c *httpConfig) {
+		c.pollBuffer = size
+	}
+}
+
+// WithAckTimeout sets how long the handler created by [NewAckableWebhookHandler] waits for acks
+// and the handler created by [NewWebhookHandler] waits for subscribers to receive a value. Default is 30 seconds.
+func WithAckTimeout(timeout time.Duration) HTTPOption {
+	return func(c *httpConfig) {
+		c.ackTimeout = timeout
+	}
+}
+
+// WithMaxPendingSends limits the number of values the handler created by [NewWebhookHandler] sends to the group
+// at once. Sends which are not received in time (see [WithAckTimeout]) keep running in background
+// and hold their place until the value is received, so a stalled subscriber can't pile up goroutines.
+// Requests wait for a free place until the timeout and respond with 503 Service Unavailable. Default is 64.
+func WithMaxPendingSends(sends int) HTTPOption {
+	return func(c *httpConfig) {
+		c.maxSends = sends
+	}
+}
+
+// WithMaxBodySize limits the size of request body accepted by [WebhookHandler]. Default is 1 MiB.
+func WithMaxBodySize(size int64) HTTPOption {
+	return func(c *httpConfig) {
+		c.maxBodySize = size
+	}
+}
+
+func (c *httpConfig) handleError(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
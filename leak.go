@@ -0,0 +1,127 @@
+package changroup
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Leak describes a copy of value which was dropped by subscriber without ack, see [WithLeakDetection].
+type Leak[T any] struct {
+	Value      T
+	Subscriber SubscriberID
+	// ReceivedAt is the time the subscriber received the copy.
+	ReceivedAt time.Time
+	// AcquireStack is the stack trace of the goroutine which acquired the subscriber's channel.
+	AcquireStack string
+}
+
+// WithLeakDetection enables debug mode to detect copies dropped by subscribers without ack.
+//
+// Each copy is tracked with a finalizer, so a leak is detected after the copy is garbage collected.
+// report is called for each detected leak from the finalizer goroutine, it must not block. It may be nil.
+// Detected leaks are also returned by [AckableGroup.CheckLeaks].
+//
+// Leaked copies stay pending. Leak detection is expensive, it's not recommended to use it in production.
+func WithLeakDetection[T any](report func(Leak[T])) AckableGroupOption[T] {
+	return func(c *ackableGroupConfig[T]) {
+		c.leaks = &leakDetector[T]{
+			report: report,
+			mu:     sync.Mutex{},
+			leaks:  nil,
+		}
+	}
+}
+
+// CheckLeaks runs garbage collection and returns copies leaked since the previous call.
+// It returns nil if leak detection is not enabled, see [WithLeakDetection].
+func (g *AckableGroup[T]) CheckLeaks() []Leak[T] {
+	if g.config.leaks == nil {
+		return nil
+	}
+	// Finalizers queued by one GC cycle run before finalizers of the next cycle.
+	// So waiting for sentinel of the second cycle guarantees that all finalizers of the first cycle are done.
+	for i := 0; i < 2; i++ {
+		runFinalizers()
+	}
+	return g.config.leaks.take()
+}
+
+// leakDetector collects leaked copies.
+type leakDetector[T any] struct {
+	report func(Leak[T])
+	mu     sync.Mutex
+	leaks  []Leak[T]
+}
+
+func (l *leakDetector[T]) add(leak Leak[T]) {
+	l.mu.Lock()
+	l.leaks = append(l.leaks, leak)
+	l.mu.Unlock()
+	if l.report != nil {
+		l.report(leak)
+	}
+}
+
+func (l *leakDetector[T]) take() []Leak[T] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	leaks := l.leaks
+	l.leaks = nil
+	return leaks
+}
+
+// leakToken is referenced only by [Ackable.Ack] of a copy. Its finalizer detects that the copy is dropped.
+type leakToken[T any] struct {
+	d          *delivery[T]
+	receivedAt time.Time // is set just before the copy is sent, zero if it's not sent
+}
+
+// newLeakTokenLocked must be called under message lock.
+func newLeakTokenLocked[T any](d *delivery[T]) *leakToken[T] {
+	d.tokens++
+	t := &leakToken[T]{d: d, receivedAt: time.Time{}}
+	runtime.SetFinalizer(t, (*leakToken[T]).finalize)
+	return t
+}
+
+func (t *leakToken[T]) ack(seq uint64, err error) {
+	t.d.ack(seq, err)
+}
+
+func (t *leakToken[T]) finalize() {
+	d := t.d
+	d.msg.mu.Lock()
+	d.tokens--
+	leaked := d.tokens == 0 && d.outcome == outcomePending && !t.receivedAt.IsZero()
+	leak := Leak[T]{
+		Value:        d.msg.original.Value,
+		Subscriber:   d.sub.id,
+		ReceivedAt:   t.receivedAt,
+		AcquireStack: d.sub.stack,
+	}
+	d.msg.mu.Unlock()
+	if leaked {
+		d.config.leaks.add(leak)
+	}
+}
+
+// runFinalizers runs GC and waits until finalizers queued by it are done.
+func runFinalizers() {
+	done := make(chan struct{})
+	setSentinel(done)
+	runtime.GC()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
+
+// sentinel has a pointer field, because finalizer may not run for objects allocated by tiny allocator.
+type sentinel struct {
+	done chan struct{}
+}
+
+func setSentinel(done chan struct{}) {
+	runtime.SetFinalizer(&sentinel{done: done}, func(s *sentinel) { close(s.done) })
+}
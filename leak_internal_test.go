@@ -0,0 +1,38 @@
+package changroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestLeakToken checks the handoff of copies without a real channel, so it doesn't depend on timing.
+func TestLeakToken(t *testing.T) {
+	t.Parallel()
+	newDelivery := func() (*AckableGroup[int], *delivery[int]) {
+		g := NewAckableGroup[int](WithLeakDetection[int](nil))
+		_, _ = g.Acquire()
+		msg := g.newMessage(NewAckable(1, nil), AckAll(), 1, false)
+		return g, msg.newDelivery(&g.config, g.channels.Snapshot()[0])
+	}
+	t.Run("copy dropped before it's marked delivered is a leak", func(t *testing.T) {
+		t.Parallel()
+		g, d := newDelivery()
+		func() { _ = d.handoff() }() // the subscriber received and dropped the copy, delivered is not called yet
+		leaks := g.CheckLeaks()
+		require.Len(t, leaks, 1)
+		require.False(t, leaks[0].ReceivedAt.IsZero())
+	})
+	t.Run("token of not sent copy is reused", func(t *testing.T) {
+		t.Parallel()
+		g, d := newDelivery()
+		copied := d.handoff()
+		d.takeBack(copied)
+		require.Empty(t, g.CheckLeaks())
+		again := d.handoff()
+		require.Same(t, copied.acker, again.acker)
+		require.Equal(t, 1, d.tokens)
+		again.Ack(nil)
+		require.Empty(t, g.CheckLeaks())
+	})
+}
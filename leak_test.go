@@ -0,0 +1,64 @@
+package changroup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestLeakDetection(t *testing.T) {
+	t.Parallel()
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		receiveAndDrop(t, ch)
+		require.Nil(t, group.CheckLeaks())
+	})
+	t.Run("detects dropped copy", func(t *testing.T) {
+		t.Parallel()
+		reported := make(chan changroup.Leak[int], 1)
+		group := changroup.NewAckableGroup(changroup.WithLeakDetection(func(leak changroup.Leak[int]) {
+			reported <- leak
+		}))
+		id, ch, _ := group.AcquireWithID()
+		before := time.Now()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		receiveAndDrop(t, ch)
+
+		leaks := group.CheckLeaks()
+		require.Len(t, leaks, 1)
+		require.Equal(t, 1, leaks[0].Value)
+		require.Equal(t, id, leaks[0].Subscriber)
+		require.False(t, leaks[0].ReceivedAt.Before(before))
+		require.Contains(t, leaks[0].AcquireStack, "leak_test.go")
+		require.Equal(t, leaks[0], waitChan(t, reported))
+
+		require.Empty(t, group.CheckLeaks()) // already returned
+	})
+	t.Run("acked copy is not a leak", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithLeakDetection[int](nil))
+		ch, _ := group.Acquire()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		waitChan(t, ch).Ack(nil)
+		require.Empty(t, group.CheckLeaks())
+	})
+	t.Run("not received copy is not a leak", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithLeakDetection[int](nil))
+		_, release := group.Acquire()
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		release()
+		require.Empty(t, group.CheckLeaks())
+	})
+}
+
+// receiveAndDrop receives a copy and drops it without ack.
+func receiveAndDrop(t *testing.T, ch <-chan changroup.Ackable[int]) {
+	require.Equal(t, 1, waitChan(t, ch).Value)
+}
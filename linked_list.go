@@ -27,21 +27,29 @@ type node[T any] struct {
 
 // Append inserts new node to the end of the list.
 func (l *list[T]) Append(elem T) *node[T] {
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	n := &node[T]{
 		elem: elem,
-		prev: l.last,
+		prev: nil,
 		next: nil,
-		list: l,
+		list: nil,
 	}
+	l.AppendNode(n)
+	return n
+}
+
+// AppendNode inserts the node to the end of the list. The node must not be in a list, a deleted node may be reused.
+func (l *list[T]) AppendNode(n *node[T]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n.prev = l.last
+	n.next = nil
+	n.list = l
 	if l.last == nil {
 		l.first = n
 	} else {
 		l.last.next = n
 	}
 	l.last = n
-	return n
 }
 
 // Delete removes node from the list.
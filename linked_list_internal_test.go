@@ -160,6 +160,23 @@ func TestList(t *testing.T) {
 		assert.Same(t, a, c.prev)
 		assert.Nil(t, c.next)
 	})
+	t.Run("append deleted node to another list", func(t *testing.T) {
+		t.Parallel()
+		l1 := newList[int]()
+		l2 := newList[int]()
+		a := l1.Append(10)
+		b := l2.Append(20)
+		a.Delete()
+
+		l2.AppendNode(a)
+
+		assertForEach(t, l1, nil)
+		assertForEach(t, l2, []int{20, 10})
+		assert.Same(t, l2, a.list)
+		assert.Same(t, b, a.prev)
+		a.Delete()
+		assertForEach(t, l2, []int{20})
+	})
 }
 
 func assertForEach[T any](t *testing.T, l *list[T], expected []T) {
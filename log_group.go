@@ -0,0 +1,253 @@
+package changroup
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOffsetEvicted is returned by [LogGroup.AcquireFrom] if the value with the offset is not retained anymore.
+	ErrOffsetEvicted = errors.New("changroup: offset is evicted")
+	// ErrOffsetOutOfRange is returned by [LogGroup.AcquireFrom] if the offset is not assigned yet.
+	ErrOffsetOutOfRange = errors.New("changroup: offset is out of range")
+)
+
+// Entry is a value sent to [LogGroup] with its offset.
+type Entry[T any] struct {
+	Offset uint64
+	Value  T
+}
+
+// LogGroupOption configures [LogGroup], see [NewLogGroup].
+type LogGroupOption[T any] func(*logGroupConfig[T])
+
+type logGroupConfig[T any] struct {
+	maxEntries   int
+	maxAge       time.Duration
+	maxBytes     int
+	sizer        Sizer[T]
+	keys         func() keyIndex[T] // creates the index of keys, compaction is enabled if it's set
+	tombstone    func(value T) bool
+	tombstoneAge time.Duration
+}
+
+// LogGroup is like [Group], but each value gets a sequential offset and is retained in memory.
+// It allows subscribers to start from any retained offset, see [LogGroup.AcquireFrom].
+//
+// Offsets start from zero and are not persisted, use [DurableGroup] to keep values between restarts.
+// By default, all values are retained. Use [WithMaxEntries], [WithMaxAge] and [WithMaxBytes] to bound memory,
+// values violating the limits are evicted in background.
+type LogGroup[T any] struct {
+	group   *Group[Entry[T]]
+	config  logGroupConfig[T]
+	sending sync.Mutex    // orders sends to the group the same way as appends to the log
+	mu      sync.Mutex    // guards the log, it's not held while sending to the group
+	entries []retained[T] // retained entries in ascending order of offsets
+	bytes   int           // total size of retained entries
+	holes   int           // number of entries removed by compaction, but still occupying the slice
+	keys    keyIndex[T]   // offsets of the latest values by key, nil if compaction is disabled
+	deletes []uint64      // offsets of tombstones in the order they are sent, see [WithTombstoneRetention]
+	next    uint64        // offset of the next value
+	replays *registry[*replay]
+	wake    chan struct{} // wakes up background trimming
+	stop    chan struct{} // is closed by Close to stop background trimming
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// NewLogGroup creates new [LogGroup].
+// [LogGroup.Close] should be called to stop background trimming if any retention limit is set.
+func NewLogGroup[T any](options ...LogGroupOption[T]) *LogGroup[T] {
+	g := &LogGroup[T]{
+		group: NewGroup[Entry[T]](),
+		config: logGroupConfig[T]{
+			maxEntries:   0,
+			maxAge:       0,
+			maxBytes:     0,
+			sizer:        nil,
+			keys:         nil,
+			tombstone:    nil,
+			tombstoneAge: 0,
+		},
+		sending: sync.Mutex{},
+		mu:      sync.Mutex{},
+		entries: nil,
+		bytes:   0,
+		holes:   0,
+		keys:    nil,
+		deletes: nil,
+		next:    0,
+		replays: newRegistry[*replay](),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: sync.WaitGroup{},
+		once:    sync.Once{},
+	}
+	for _, option := range options {
+		option(&g.config)
+	}
+	if g.config.keys != nil {
+		g.keys = g.config.keys()
+	}
+	if g.config.limited() {
+		g.stopped.Add(1)
+		go g.trimLoop()
+	}
+	return g
+}
+
+// Close stops background trimming and releases all acquired channels.
+// The group must not be used after that. It's safe to call Close several times.
+func (g *LogGroup[T]) Close() {
+	g.once.Do(func() {
+		close(g.stop)
+		g.stopped.Wait()
+		g.ReleaseAll()
+	})
+}
+
+// Earliest returns the offset of the oldest retained value. It returns false if no value is retained.
+func (g *LogGroup[T]) Earliest() (uint64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.entries) == 0 {
+		return 0, false
+	}
+	return g.entries[0].entry.Offset, true
+}
+
+// Latest returns the offset of the newest retained value. It returns false if no value is retained.
+func (g *LogGroup[T]) Latest() (uint64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := len(g.entries) - 1; i >= 0; i-- {
+		if !g.entries[i].removed { // the newest value may be an expired tombstone, see [WithTombstoneRetention]
+			return g.entries[i].entry.Offset, true
+		}
+	}
+	return 0, false
+}
+
+// ReleaseAll releases all acquired channels and closes them.
+// It's safe to call [LogGroup.ReleaseAll] several times as well as in parallel with [ReleaseFunc].
+func (g *LogGroup[T]) ReleaseAll() {
+	g.group.ReleaseAll()
+	for _, r := range g.replays.RemoveAll() {
+		r.release()
+	}
+}
+
+// Acquire creates new channel and adds it to group. The channel receives only values sent after the call.
+//
+// [ReleaseFunc] is returned as the second value.
+// It should be called to remove the channel from the group and close it.
+// It's safe to call [ReleaseFunc] several times as well as in parallel with [LogGroup.ReleaseAll].
+func (g *LogGroup[T]) Acquire() (<-chan Entry[T], ReleaseFunc) {
+	return g.group.Acquire()
+}
+
+// AcquireFrom is like [LogGroup.Acquire], but the channel receives retained values starting from the offset first
+// and then values sent after the call. No value is missed or duplicated on the switch.
+// The offset equal to the offset of the next value is the same as [LogGroup.Acquire].
+//
+// It returns [ErrOffsetEvicted] if the offset is less than the offset of the oldest retained value
+// and [ErrOffsetOutOfRange] if the offset is greater than the offset of the next value.
+//
+// [LogGroup.Send] waits for the channel like for any other, so a slow replay slows down senders.
+func (g *LogGroup[T]) AcquireFrom(offset uint64) (<-chan Entry[T], ReleaseFunc, error) {
+	g.mu.Lock()
+	earliest := g.earliestLocked()
+	if offset < earliest {
+		g.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: %d, the oldest retained is %d", ErrOffsetEvicted, offset, earliest)
+	}
+	if offset > g.next {
+		g.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: %d, the next is %d", ErrOffsetOutOfRange, offset, g.next)
+	}
+	start := sort.Search(len(g.entries), func(i int) bool { return g.entries[i].entry.Offset >= offset })
+	backlog := make([]Entry[T], 0, len(g.entries)-start)
+	for _, r := range g.entries[start:] {
+		if !r.removed {
+			backlog = append(backlog, r.entry)
+		}
+	}
+	live, releaseLive := g.group.Acquire()
+	next := g.next
+	g.mu.Unlock()
+
+	ch, release := g.replay(backlog, next, live, releaseLive)
+	return ch, release, nil
+}
+
+// replay creates a channel which receives the backlog and then values from the live channel
+// starting from the offset next. Values being sent while the live channel is acquired are in the backlog,
+// but may be received from the live channel too.
+func (g *LogGroup[T]) replay(
+	backlog []Entry[T], next uint64, live <-chan Entry[T], releaseLive ReleaseFunc,
+) (<-chan Entry[T], ReleaseFunc) {
+	send := func(out chan<- Entry[T], done <-chan struct{}) bool {
+		for _, entry := range backlog {
+			select {
+			case out <- entry:
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}
+	return acquireReplay(g.replays, live, releaseLive, send, func(entry Entry[T]) (Entry[T], bool) {
+		return entry, entry.Offset >= next
+	})
+}
+
+// earliestLocked returns the offset of the oldest retained value or the offset of the next value
+// if no value is retained. It must be called under lock.
+func (g *LogGroup[T]) earliestLocked() uint64 {
+	if len(g.entries) == 0 {
+		return g.next
+	}
+	return g.entries[0].entry.Offset
+}
+
+// Send assigns the next offset to the value, retains it and sends to each acquired channel like [Group.Send].
+// It returns the offset.
+// Values are retained and sent in the same order, so concurrent calls are serialized.
+// The log is not locked while sending, so a slow channel doesn't block trimming and acquiring.
+func (g *LogGroup[T]) Send(value T) uint64 {
+	g.sending.Lock()
+	defer g.sending.Unlock()
+	entry := g.append(value)
+	g.group.Send(entry)
+	return entry.Offset
+}
+
+// append assigns the next offset to the value and retains it.
+func (g *LogGroup[T]) append(value T) Entry[T] {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry := Entry[T]{Offset: g.next, Value: value}
+	g.next++
+	r := retained[T]{entry: entry, at: time.Time{}, size: 0, tombstone: false, removed: false}
+	if g.config.maxAge > 0 || g.config.tombstoneAge > 0 {
+		r.at = time.Now()
+	}
+	if g.config.maxBytes > 0 && g.config.sizer != nil {
+		r.size = g.config.sizer.Size(value)
+	}
+	if g.keys != nil {
+		g.compact(&r)
+	}
+	g.entries = append(g.entries, r)
+	g.bytes += r.size
+	if g.config.limited() {
+		select {
+		case g.wake <- struct{}{}:
+		default: // trimming is already pending
+		}
+	}
+	return entry
+}
@@ -0,0 +1,355 @@
+package changroup_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestLogGroup(t *testing.T) {
+	t.Parallel()
+	t.Run("assigns sequential offsets", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[string]()
+		defer group.ReleaseAll()
+		require.Equal(t, uint64(0), group.Send("a"))
+		require.Equal(t, uint64(1), group.Send("b"))
+		ch, _ := group.Acquire()
+		go group.Send("c")
+		require.Equal(t, changroup.Entry[string]{Offset: 2, Value: "c"}, waitChan(t, ch))
+	})
+	t.Run("AcquireFrom receives retained and then new values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.ReleaseAll()
+		for i := 0; i < 5; i++ {
+			group.Send(i * 10)
+		}
+		ch, release, err := group.AcquireFrom(2)
+		require.NoError(t, err)
+		defer release()
+		go group.Send(50)
+		for i := 2; i <= 5; i++ {
+			require.Equal(t, changroup.Entry[int]{Offset: uint64(i), Value: i * 10}, waitChan(t, ch))
+		}
+	})
+	t.Run("AcquireFrom the next offset receives only new values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.ReleaseAll()
+		group.Send(0)
+		ch, _, err := group.AcquireFrom(1)
+		require.NoError(t, err)
+		go group.Send(1)
+		require.Equal(t, changroup.Entry[int]{Offset: 1, Value: 1}, waitChan(t, ch))
+	})
+	t.Run("no value is missed or duplicated on switch to live", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.ReleaseAll()
+		const n = 1000
+		go func() {
+			for i := 0; i < n; i++ {
+				group.Send(i)
+			}
+		}()
+		ch, release, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		defer release()
+		for i := 0; i < n; i++ {
+			require.Equal(t, uint64(i), waitChan(t, ch).Offset)
+		}
+	})
+	t.Run("AcquireFrom evicted offset fails", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxEntries[int](2))
+		defer group.Close()
+		for i := 0; i < 5; i++ {
+			group.Send(i)
+		}
+		waitEarliest(t, group, 3)
+		_, _, err := group.AcquireFrom(2)
+		require.True(t, errors.Is(err, changroup.ErrOffsetEvicted))
+		ch, release, err := group.AcquireFrom(3)
+		require.NoError(t, err)
+		defer release()
+		require.Equal(t, 3, waitChan(t, ch).Value)
+		require.Equal(t, 4, waitChan(t, ch).Value)
+	})
+	t.Run("AcquireFrom future offset fails", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.ReleaseAll()
+		group.Send(0)
+		_, _, err := group.AcquireFrom(2)
+		require.True(t, errors.Is(err, changroup.ErrOffsetOutOfRange))
+	})
+	t.Run("slow channel doesn't block the log", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.ReleaseAll()
+		_, releaseSlow := group.Acquire()
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			group.Send(0)
+		}()
+		waitCondition(t, func() bool {
+			latest, ok := group.Latest()
+			return ok && latest == 0
+		})
+		earliest, ok := group.Earliest()
+		require.True(t, ok)
+		require.Equal(t, uint64(0), earliest)
+		ch, release, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		defer release()
+		require.Equal(t, 0, waitChan(t, ch).Value)
+		assertChanBlocked(t, sent)
+		releaseSlow()
+		waitChan(t, sent)
+		go group.Send(1)
+		require.Equal(t, changroup.Entry[int]{Offset: 1, Value: 1}, waitChan(t, ch)) // 0 is not duplicated
+	})
+	t.Run("release closes channel", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		group.Send(0)
+		ch1, release, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		ch2, _, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		release()
+		release()
+		assertChanClosed(t, ch1)
+		group.ReleaseAll()
+		assertChanClosed(t, ch2)
+	})
+}
+
+func TestLogGroupRetention(t *testing.T) {
+	t.Parallel()
+	t.Run("retains all values by default", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.Close()
+		_, ok := group.Earliest()
+		require.False(t, ok)
+		_, ok = group.Latest()
+		require.False(t, ok)
+		for i := 0; i < 100; i++ {
+			group.Send(i)
+		}
+		requireBounds(t, group, 0, 99)
+	})
+	t.Run("by count", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxEntries[int](10))
+		defer group.Close()
+		for i := 0; i < 100; i++ {
+			group.Send(i)
+		}
+		waitEarliest(t, group, 90)
+		requireBounds(t, group, 90, 99)
+	})
+	t.Run("by age", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxAge[int](100 * time.Millisecond))
+		defer group.Close()
+		group.Send(0)
+		time.Sleep(50 * time.Millisecond)
+		group.Send(1)
+		requireBounds(t, group, 0, 1)
+		waitEarliest(t, group, 1)
+		waitCondition(t, func() bool {
+			_, ok := group.Earliest()
+			return !ok
+		})
+		_, ok := group.Latest()
+		require.False(t, ok)
+		_, _, err := group.AcquireFrom(1)
+		require.True(t, errors.Is(err, changroup.ErrOffsetEvicted))
+		_, _, err = group.AcquireFrom(2)
+		require.NoError(t, err)
+	})
+	t.Run("by bytes", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[string](changroup.WithMaxBytes[string](10, changroup.SizerFunc[string](
+			func(value string) int { return len(value) },
+		)))
+		defer group.Close()
+		group.Send("12345")
+		group.Send("123")
+		group.Send("12")
+		requireBounds(t, group, 0, 2)
+		group.Send("1")
+		waitEarliest(t, group, 1)
+		group.Send("1234567890")
+		waitEarliest(t, group, 4)
+		requireBounds(t, group, 4, 4)
+	})
+	t.Run("by encoded bytes", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxBytes[int](4, changroup.CodecSizer[int](intCodec{})))
+		defer group.Close()
+		group.Send(10)
+		group.Send(20)
+		requireBounds(t, group, 0, 1)
+		group.Send(3)
+		waitEarliest(t, group, 1)
+	})
+	t.Run("Close releases channels", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxEntries[int](1))
+		group.Send(0)
+		ch1, _ := group.Acquire()
+		ch2, _, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		group.Close()
+		group.Close()
+		assertChanClosed(t, ch1)
+		assertChanClosed(t, ch2)
+	})
+}
+
+// waitEarliest waits until the oldest retained value has the offset.
+func waitEarliest[T any](t *testing.T, group *changroup.LogGroup[T], offset uint64) {
+	t.Helper()
+	waitCondition(t, func() bool {
+		earliest, ok := group.Earliest()
+		return ok && earliest == offset
+	})
+}
+
+func requireBounds[T any](t *testing.T, group *changroup.LogGroup[T], earliest, latest uint64) {
+	t.Helper()
+	actual, ok := group.Earliest()
+	require.True(t, ok)
+	require.Equal(t, earliest, actual)
+	actual, ok = group.Latest()
+	require.True(t, ok)
+	require.Equal(t, latest, actual)
+}
+
+func TestLogGroupCompaction(t *testing.T) {
+	t.Parallel()
+	type record struct {
+		key   string
+		value int // zero value is a tombstone
+	}
+	newGroup := func(options ...changroup.LogGroupOption[record]) *changroup.LogGroup[record] {
+		options = append(options, changroup.WithCompaction(
+			func(r record) string { return r.key },
+			func(r record) bool { return r.value == 0 },
+		))
+		return changroup.NewLogGroup[record](options...)
+	}
+	t.Run("snapshot contains the latest value for each key", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		defer group.Close()
+		group.Send(record{key: "a", value: 1})
+		group.Send(record{key: "b", value: 1})
+		group.Send(record{key: "a", value: 2})
+		group.Send(record{key: "c", value: 1})
+		group.Send(record{key: "c", value: 0})
+		ch, release := group.AcquireSnapshot()
+		defer release()
+		require.Equal(t, changroup.Entry[record]{Offset: 1, Value: record{key: "b", value: 1}}, waitChan(t, ch))
+		require.Equal(t, changroup.Entry[record]{Offset: 2, Value: record{key: "a", value: 2}}, waitChan(t, ch))
+		go group.Send(record{key: "b", value: 2})
+		require.Equal(t, changroup.Entry[record]{Offset: 5, Value: record{key: "b", value: 2}}, waitChan(t, ch))
+	})
+	t.Run("AcquireFrom receives tombstones", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup()
+		defer group.Close()
+		group.Send(record{key: "a", value: 1})
+		group.Send(record{key: "b", value: 1})
+		group.Send(record{key: "a", value: 0})
+		requireBounds(t, group, 1, 2)
+		_, _, err := group.AcquireFrom(0)
+		require.True(t, errors.Is(err, changroup.ErrOffsetEvicted))
+		ch, release, err := group.AcquireFrom(1)
+		require.NoError(t, err)
+		defer release()
+		require.Equal(t, record{key: "b", value: 1}, waitChan(t, ch).Value)
+		require.Equal(t, record{key: "a", value: 0}, waitChan(t, ch).Value)
+	})
+	t.Run("retention counts only not removed values", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup(changroup.WithMaxEntries[record](2))
+		defer group.Close()
+		for i := 1; i <= 100; i++ {
+			group.Send(record{key: "a", value: i})
+		}
+		group.Send(record{key: "b", value: 1})
+		requireBounds(t, group, 99, 100)
+		group.Send(record{key: "c", value: 1})
+		waitEarliest(t, group, 100)
+		ch, release := group.AcquireSnapshot()
+		defer release()
+		require.Equal(t, record{key: "b", value: 1}, waitChan(t, ch).Value)
+		require.Equal(t, record{key: "c", value: 1}, waitChan(t, ch).Value)
+		release()
+		group.Send(record{key: "a", value: 1}) // the previous value of "a" is evicted already
+		waitEarliest(t, group, 101)
+		requireBounds(t, group, 101, 102)
+	})
+	t.Run("tombstones expire", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup(changroup.WithTombstoneRetention[record](200 * time.Millisecond))
+		defer group.Close()
+		group.Send(record{key: "x", value: 0})
+		group.Send(record{key: "a", value: 1})
+		group.Send(record{key: "b", value: 1})
+		group.Send(record{key: "b", value: 0})
+		group.Send(record{key: "c", value: 0})
+		group.Send(record{key: "c", value: 1}) // the tombstone is removed by a newer value before expiration
+		requireBounds(t, group, 0, 5)
+		waitEarliest(t, group, 1)
+		waitCondition(t, func() bool {
+			ch, release, err := group.AcquireFrom(1)
+			require.NoError(t, err)
+			defer release()
+			require.Equal(t, uint64(1), waitChan(t, ch).Offset)
+			return waitChan(t, ch).Offset == 5
+		})
+		group.Send(record{key: "b", value: 2}) // the key is deleted, so nothing is removed
+		ch, release := group.AcquireSnapshot()
+		defer release()
+		require.Equal(t, record{key: "a", value: 1}, waitChan(t, ch).Value)
+		require.Equal(t, record{key: "c", value: 1}, waitChan(t, ch).Value)
+		require.Equal(t, record{key: "b", value: 2}, waitChan(t, ch).Value)
+	})
+	t.Run("latest skips expired tombstone", func(t *testing.T) {
+		t.Parallel()
+		group := newGroup(changroup.WithTombstoneRetention[record](time.Millisecond))
+		defer group.Close()
+		group.Send(record{key: "a", value: 1})
+		group.Send(record{key: "b", value: 0})
+		waitCondition(t, func() bool {
+			latest, ok := group.Latest()
+			return ok && latest == 0
+		})
+		ch, release, err := group.AcquireFrom(0)
+		require.NoError(t, err)
+		defer release()
+		require.Equal(t, changroup.Entry[record]{Offset: 0, Value: record{key: "a", value: 1}}, waitChan(t, ch))
+	})
+	t.Run("snapshot without compaction contains all retained values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.Close()
+		group.Send(1)
+		group.Send(1)
+		ch, release := group.AcquireSnapshot()
+		defer release()
+		require.Equal(t, uint64(0), waitChan(t, ch).Offset)
+		require.Equal(t, uint64(1), waitChan(t, ch).Offset)
+	})
+}
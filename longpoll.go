@@ -0,0 +1,382 @@
+package changroup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = time.Minute
+	pollIDSize         = 16
+)
+
+var (
+	errNotJSON           = errors.New("changroup: encoded value is not JSON")
+	errCursorOutOfRange  = errors.New("cursor is out of range")
+	errSubscriptionEnded = errors.New("subscription is closed")
+)
+
+// LongPoll exposes a group to HTTP clients which can't hold a stream open.
+//
+// A client creates a subscription using [LongPoll.SubscribeHandler] and then polls it using [LongPoll.PollHandler].
+// Each subscription acquires its own channel from the group and buffers received values between polls.
+// It's released if it's not polled for a while, see [WithIdleTimeout].
+//
+// Values are returned in JSON, so the codec must produce JSON, e.g. [JSONCodec].
+type LongPoll[T any] struct {
+	group  *Group[T]
+	codec  Codec[T]
+	config httpConfig
+	mu     sync.Mutex
+	subs   map[string]*pollSubscription
+	closed bool
+}
+
+// pollResponse is the body of successful response of [LongPoll] handlers.
+type pollResponse struct {
+	ID     string            `json:"id,omitempty"`
+	Cursor uint64            `json:"cursor"`
+	Missed uint64            `json:"missed,omitempty"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// NewLongPoll creates [LongPoll] for the group. [LongPoll.Close] should be called to release subscriptions.
+func NewLongPoll[T any](group *Group[T], codec Codec[T], options ...HTTPOption) *LongPoll[T] {
+	return &LongPoll[T]{
+		group:  group,
+		codec:  codec,
+		config: newHTTPConfig(options),
+		mu:     sync.Mutex{},
+		subs:   map[string]*pollSubscription{},
+		closed: false,
+	}
+}
+
+// Close releases all subscriptions. Subscribe requests fail with 503 Service Unavailable after that.
+// It's safe to call Close several times.
+func (p *LongPoll[T]) Close() {
+	p.mu.Lock()
+	p.closed = true
+	subs := make([]*pollSubscription, 0, len(p.subs))
+	for _, sub := range p.subs {
+		subs = append(subs, sub)
+	}
+	p.mu.Unlock()
+	for _, sub := range subs {
+		p.unsubscribe(sub)
+	}
+}
+
+// SubscribeHandler returns a handler which creates a subscription on POST request.
+// It responds with 201 Created and JSON like {"id": "...", "cursor": 0, "values": []}.
+// The subscription receives values sent after the request.
+func (p *LongPoll[T]) SubscribeHandler() http.Handler {
+	return http.HandlerFunc(p.subscribe)
+}
+
+// PollHandler returns a handler which polls a subscription on GET request and deletes it on DELETE request.
+// The subscription is passed in "id" query parameter.
+//
+// GET request also accepts "cursor" (the cursor from the previous response, zero by default)
+// and "timeout" (how long to wait for values, in seconds, 30 by default, 60 at most) parameters.
+// It responds with JSON like {"cursor": 5, "values": [...]} as soon as there are values after the cursor,
+// or with no values after the timeout. Values before the cursor are considered received and dropped from buffer.
+// So if a response is lost, polling with the same cursor returns the same values again.
+// The "missed" field contains the number of values dropped because the buffer was full, see [WithPollBuffer].
+//
+// It responds with 404 Not Found if the subscription doesn't exist (e.g. it's expired)
+// and with 410 Gone if the channel of the subscription is released (e.g. by [Group.ReleaseAll]).
+func (p *LongPoll[T]) PollHandler() http.Handler {
+	return http.HandlerFunc(p.poll)
+}
+
+func (p *LongPoll[T]) subscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := newPollID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ch, release := p.group.Acquire()
+	sub := &pollSubscription{
+		id:      id,
+		release: release,
+		timer:   nil,
+		mu:      sync.Mutex{},
+		values:  nil,
+		first:   0,
+		ready:   make(chan struct{}),
+		ended:   false,
+		polls:   1, // the subscription doesn't expire until the client receives its id
+		expired: false,
+	}
+	sub.mu.Lock()
+	sub.timer = time.AfterFunc(p.config.idleTimeout, func() { p.expire(sub) })
+	sub.mu.Unlock()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		sub.timer.Stop()
+		release()
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	p.subs[id] = sub
+	p.mu.Unlock()
+	go p.collect(sub, ch)
+	p.writeJSON(w, http.StatusCreated, pollResponse{ID: id, Cursor: 0, Missed: 0, Values: []json.RawMessage{}})
+	sub.endPoll(p.config.idleTimeout)
+}
+
+// collect buffers values received from the channel until it's closed.
+func (p *LongPoll[T]) collect(sub *pollSubscription, ch <-chan T) {
+	for value := range ch {
+		data, err := p.codec.Encode(value)
+		if err == nil && !json.Valid(data) {
+			err = errNotJSON
+		}
+		if err != nil {
+			p.config.handleError(fmt.Errorf("changroup: encode value: %w", err))
+			continue
+		}
+		sub.push(data, p.config.pollBuffer)
+	}
+	sub.end()
+}
+
+func (p *LongPoll[T]) poll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	p.mu.Lock()
+	sub := p.subs[query.Get("id")]
+	p.mu.Unlock()
+	if sub == nil {
+		http.Error(w, "subscription is not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		p.unsubscribe(sub)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	cursor, timeout, err := parsePollQuery(query.Get("cursor"), query.Get("timeout"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sub.startPoll() {
+		http.Error(w, "subscription is not found", http.StatusNotFound)
+		return
+	}
+	defer sub.endPoll(p.config.idleTimeout)
+	resp, err := sub.wait(r.Context(), cursor, timeout)
+	switch {
+	case errors.Is(err, errCursorOutOfRange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errSubscriptionEnded):
+		p.forget(sub)
+		http.Error(w, err.Error(), http.StatusGone)
+	case err != nil: // the client is gone
+	default:
+		p.writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func parsePollQuery(cursorParam, timeoutParam string) (uint64, time.Duration, error) {
+	cursor := uint64(0)
+	if cursorParam != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(cursorParam, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+	timeout := defaultPollTimeout
+	if timeoutParam != "" {
+		seconds, err := strconv.ParseFloat(timeoutParam, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("invalid timeout: %q", timeoutParam)
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+	return cursor, timeout, nil
+}
+
+// expire releases the subscription if it's not polled. It's called by the idle timer.
+func (p *LongPoll[T]) expire(sub *pollSubscription) {
+	sub.mu.Lock()
+	if sub.polls > 0 || sub.expired {
+		sub.mu.Unlock()
+		return
+	}
+	sub.expired = true
+	sub.mu.Unlock()
+	p.forget(sub)
+}
+
+// unsubscribe releases the subscription even if it's polled.
+func (p *LongPoll[T]) unsubscribe(sub *pollSubscription) {
+	sub.mu.Lock()
+	sub.expired = true
+	sub.timer.Stop()
+	sub.mu.Unlock()
+	p.forget(sub)
+}
+
+// forget removes the subscription and releases its channel.
+func (p *LongPoll[T]) forget(sub *pollSubscription) {
+	p.mu.Lock()
+	if p.subs[sub.id] == sub {
+		delete(p.subs, sub.id)
+	}
+	p.mu.Unlock()
+	sub.release()
+}
+
+func (p *LongPoll[T]) writeJSON(w http.ResponseWriter, status int, resp pollResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		p.config.handleError(fmt.Errorf("changroup: write poll response: %w", err))
+	}
+}
+
+func newPollID() (string, error) {
+	id := make([]byte, pollIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("changroup: generate subscription id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// pollSubscription is a subscription of [LongPoll].
+type pollSubscription struct {
+	id      string
+	release ReleaseFunc
+	timer   *time.Timer // expires the subscription when it's idle
+	mu      sync.Mutex
+	values  []json.RawMessage // buffered values, values[i] has cursor first+i
+	first   uint64
+	ready   chan struct{} // is closed and replaced when a value is buffered or the channel is closed
+	ended   bool          // the channel is closed
+	polls   int           // number of polls in progress
+	expired bool
+}
+
+// push buffers the value and drops the oldest ones if there are more than limit.
+func (s *pollSubscription) push(value json.RawMessage, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = append(s.values, value)
+	if limit > 0 && len(s.values) > limit {
+		s.drop(len(s.values) - limit)
+	}
+	s.notify()
+}
+
+// end marks the channel as closed.
+func (s *pollSubscription) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	s.notify()
+}
+
+// notify wakes up polls. It must be called under lock.
+func (s *pollSubscription) notify() {
+	close(s.ready)
+	s.ready = make(chan struct{})
+}
+
+// drop removes n oldest values. It must be called under lock.
+func (s *pollSubscription) drop(n int) {
+	for i := 0; i < n; i++ {
+		s.values[i] = nil
+	}
+	s.values = s.values[n:]
+	s.first += uint64(n)
+}
+
+// startPoll stops the idle timer. It returns false if the subscription is expired.
+func (s *pollSubscription) startPoll() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired {
+		return false
+	}
+	s.polls++
+	s.timer.Stop()
+	return true
+}
+
+// endPoll restarts the idle timer if there are no other polls.
+func (s *pollSubscription) endPoll(idleTimeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls--
+	if s.polls == 0 && !s.expired {
+		s.timer.Reset(idleTimeout)
+	}
+}
+
+// wait drops values before the cursor and returns the values after it.
+// It waits for values until timeout if there are no such values.
+func (s *pollSubscription) wait(ctx context.Context, cursor uint64, timeout time.Duration) (pollResponse, error) {
+	var none pollResponse
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	timedOut := false
+	for {
+		s.mu.Lock()
+		next := s.first + uint64(len(s.values))
+		if cursor > next {
+			s.mu.Unlock()
+			return none, fmt.Errorf("%w: %d, the next is %d", errCursorOutOfRange, cursor, next)
+		}
+		if cursor > s.first {
+			s.drop(int(cursor - s.first))
+		}
+		if len(s.values) == 0 && s.ended {
+			s.mu.Unlock()
+			return none, errSubscriptionEnded
+		}
+		if len(s.values) > 0 || timedOut {
+			resp := pollResponse{
+				ID:     "",
+				Cursor: next,
+				Missed: s.first - cursor,
+				Values: append([]json.RawMessage{}, s.values...),
+			}
+			s.mu.Unlock()
+			return resp, nil
+		}
+		ready := s.ready
+		s.mu.Unlock()
+		select {
+		case <-ready:
+		case <-timer.C:
+			timedOut = true
+		case <-ctx.Done():
+			return none, ctx.Err() //nolint:wrapcheck // the client is gone, the error is not returned to anyone
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package changroup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestLongPollExpire calls expire like the idle timer does, so the tests don't depend on timing.
+func TestLongPollExpire(t *testing.T) {
+	t.Parallel()
+	newLongPoll := func(t *testing.T) *LongPoll[int] {
+		t.Helper()
+		p := NewLongPoll[int](NewGroup[int](), JSONCodec[int]{}, WithIdleTimeout(time.Hour)) // the timer never fires
+		t.Cleanup(p.Close)
+		return p
+	}
+	t.Run("idle subscription expires", func(t *testing.T) {
+		t.Parallel()
+		p := newLongPoll(t)
+		id := subscribePoll(t, p, nil)
+		p.expire(pollSub(p, id))
+		require.Nil(t, pollSub(p, id))
+		require.Equal(t, http.StatusNotFound, pollStatus(p, id))
+	})
+	t.Run("polled subscription doesn't expire", func(t *testing.T) {
+		t.Parallel()
+		p := newLongPoll(t)
+		id := subscribePoll(t, p, nil)
+		sub := pollSub(p, id)
+		require.True(t, sub.startPoll())
+		p.expire(sub)
+		require.NotNil(t, pollSub(p, id))
+		sub.endPoll(time.Hour)
+		p.expire(sub)
+		require.Nil(t, pollSub(p, id))
+		require.False(t, sub.startPoll())
+	})
+	t.Run("subscription doesn't expire before the client receives its id", func(t *testing.T) {
+		t.Parallel()
+		p := newLongPoll(t)
+		id := subscribePoll(t, p, func() {
+			p.mu.Lock()
+			subs := make([]*pollSubscription, 0, len(p.subs))
+			for _, sub := range p.subs {
+				subs = append(subs, sub)
+			}
+			p.mu.Unlock()
+			for _, sub := range subs {
+				p.expire(sub) // the idle timer fires while the response is written
+			}
+		})
+		require.Equal(t, http.StatusOK, pollStatus(p, id))
+	})
+}
+
+// subscribePoll creates a subscription and returns its id. beforeWrite is called before the response is written.
+func subscribePoll[T any](t *testing.T, p *LongPoll[T], beforeWrite func()) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = rec
+	if beforeWrite != nil {
+		w = hookedWriter{ResponseWriter: rec, beforeWrite: beforeWrite}
+	}
+	p.SubscribeHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/subscribe", nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp pollResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	return resp.ID
+}
+
+// pollStatus polls the subscription without waiting and returns the status code.
+func pollStatus[T any](p *LongPoll[T], id string) int {
+	rec := httptest.NewRecorder()
+	p.PollHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/poll?timeout=0&id="+id, nil))
+	return rec.Code
+}
+
+// pollSub returns the subscription or nil if it doesn't exist.
+func pollSub[T any](p *LongPoll[T], id string) *pollSubscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.subs[id]
+}
+
+type hookedWriter struct {
+	http.ResponseWriter
+	beforeWrite func()
+}
+
+func (w hookedWriter) WriteHeader(statusCode int) {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
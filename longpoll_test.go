@@ -0,0 +1,153 @@
+package changroup_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+type pollResult struct {
+	ID     string `json:"id"`
+	Cursor uint64 `json:"cursor"`
+	Missed uint64 `json:"missed"`
+	Values []int  `json:"values"`
+}
+
+func TestLongPoll(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, group *changroup.Group[int], options ...changroup.HTTPOption) *pollClient {
+		t.Helper()
+		lp := changroup.NewLongPoll[int](group, changroup.JSONCodec[int]{}, options...)
+		mux := http.NewServeMux()
+		mux.Handle("/subscribe", lp.SubscribeHandler())
+		mux.Handle("/poll", lp.PollHandler())
+		server := httptest.NewServer(mux)
+		t.Cleanup(func() {
+			server.Close()
+			lp.Close()
+		})
+		return &pollClient{t: t, url: server.URL}
+	}
+	t.Run("polls values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		client := newServer(t, group)
+		id := client.subscribe()
+		group.Send(1)
+		group.Send(2)
+		status, result := client.poll(id, 0, "")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []int{1, 2}, result.Values)
+		require.Equal(t, uint64(2), result.Cursor)
+
+		_, again := client.poll(id, 0, "") // response is lost, poll again
+		require.Equal(t, result, again)
+
+		go group.Send(3)
+		_, result = client.poll(id, 2, "")
+		require.Equal(t, []int{3}, result.Values)
+		require.Equal(t, uint64(3), result.Cursor)
+
+		status, result = client.poll(id, 3, "0.01")
+		require.Equal(t, http.StatusOK, status)
+		require.Empty(t, result.Values)
+		require.Equal(t, uint64(3), result.Cursor)
+
+		status, result = client.poll(id, 1, "0") // values before 3 are already dropped
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, pollResult{ID: "", Cursor: 3, Missed: 2, Values: []int{}}, result)
+	})
+	t.Run("drops the oldest values if buffer is full", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		client := newServer(t, group, changroup.WithPollBuffer(2))
+		id := client.subscribe()
+		for i := 1; i <= 5; i++ {
+			group.Send(i)
+		}
+		var result pollResult
+		waitCondition(t, func() bool {
+			_, result = client.poll(id, 0, "0")
+			return result.Cursor == 5
+		})
+		require.Equal(t, []int{4, 5}, result.Values)
+		require.Equal(t, uint64(3), result.Missed)
+	})
+	t.Run("delete releases subscription", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		client := newServer(t, group)
+		id := client.subscribe()
+		require.Equal(t, http.StatusNoContent, client.do(http.MethodDelete, "/poll?id="+id, nil))
+		status, _ := client.poll(id, 0, "0")
+		require.Equal(t, http.StatusNotFound, status)
+		assertDoesNotStuck(t, group.Send, 1)
+	})
+	t.Run("released channel", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		client := newServer(t, group)
+		id := client.subscribe()
+		group.Send(1)
+		group.ReleaseAll()
+		_, result := client.poll(id, 0, "")
+		require.Equal(t, []int{1}, result.Values)
+		status, _ := client.poll(id, 1, "")
+		require.Equal(t, http.StatusGone, status)
+		status, _ = client.poll(id, 1, "")
+		require.Equal(t, http.StatusNotFound, status)
+	})
+	t.Run("bad requests", func(t *testing.T) {
+		t.Parallel()
+		client := newServer(t, changroup.NewGroup[int]())
+		id := client.subscribe()
+		status, _ := client.poll(id, 1, "0")
+		require.Equal(t, http.StatusBadRequest, status)
+		status, _ = client.poll(id, 0, "-1")
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodGet, "/poll?id="+id+"&cursor=x", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, client.do(http.MethodGet, "/subscribe", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, client.do(http.MethodPost, "/poll?id="+id, nil))
+	})
+}
+
+type pollClient struct {
+	t   *testing.T
+	url string
+}
+
+func (c *pollClient) subscribe() string {
+	var result pollResult
+	require.Equal(c.t, http.StatusCreated, c.do(http.MethodPost, "/subscribe", &result))
+	require.NotEmpty(c.t, result.ID)
+	return result.ID
+}
+
+func (c *pollClient) poll(id string, cursor uint64, timeout string) (int, pollResult) {
+	query := url.Values{"id": {id}, "cursor": {strconv.FormatUint(cursor, 10)}}
+	if timeout != "" {
+		query.Set("timeout", timeout)
+	}
+	var result pollResult
+	status := c.do(http.MethodGet, "/poll?"+query.Encode(), &result)
+	return status, result
+}
+
+func (c *pollClient) do(method, path string, result *pollResult) int {
+	req, err := http.NewRequest(method, c.url+path, nil) //nolint:noctx // test
+	require.NoError(c.t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode < http.StatusMultipleChoices {
+		require.NoError(c.t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,58 @@
+package changroup
+
+import "sync"
+
+// opKind is a kind of send operation of [Group].
+type opKind int
+
+const (
+	opSend opKind = iota
+	opSendMany
+	opSendAsync
+	opSendAsyncOrdered
+)
+
+// op is a state of a single send operation of [Group].
+// It's pooled, so the send doesn't allocate if all channels are ready to receive.
+type op[T any] struct {
+	kind   opKind
+	value  T
+	values []T
+	wg     sync.WaitGroup // waits for all channels to receive the value(s), used by opSend and opSendMany only
+}
+
+// opPool is a pool of send operations.
+type opPool[T any] struct {
+	pool sync.Pool
+}
+
+func newOpPool[T any]() *opPool[T] {
+	return &opPool[T]{
+		pool: sync.Pool{
+			New: func() any {
+				var zero T
+				return &op[T]{
+					kind:   opSend,
+					value:  zero,
+					values: nil,
+					wg:     sync.WaitGroup{},
+				}
+			},
+		},
+	}
+}
+
+// get returns operation of the kind from the pool.
+func (p *opPool[T]) get(kind opKind) *op[T] {
+	o, _ := p.pool.Get().(*op[T]) // pool contains only *op[T]
+	o.kind = kind
+	return o
+}
+
+// put returns operation to the pool. Its wait group must not be in use.
+func (p *opPool[T]) put(o *op[T]) {
+	var zero T
+	o.value = zero // to not retain references
+	o.values = nil
+	p.pool.Put(o)
+}
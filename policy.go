@@ -0,0 +1,80 @@
+package changroup
+
+import "math"
+
+// AckPolicy defines when original [Ackable.Ack] is called by [AckableGroup].
+//
+// The zero value is the same as [AckAll].
+// [AckAll] waits until every copy is resolved: acked by subscriber, dead lettered
+// or not received because the subscriber is released.
+// Other policies count only copies acked by subscribers with nil error.
+// If the rest of copies can't satisfy such policy anymore, original ack is called with [ErrQuorumNotReached].
+type AckPolicy struct {
+	n        int
+	fraction float64
+}
+
+// AckAll returns policy to call original ack after all copies are acked. It's the default policy.
+func AckAll() AckPolicy {
+	return AckPolicy{
+		n:        0,
+		fraction: 0,
+	}
+}
+
+// AckAny returns policy to call original ack after any copy is acked.
+func AckAny() AckPolicy {
+	return AckN(1)
+}
+
+// AckN returns policy to call original ack after n copies are acked.
+// If there are less than n copies, all of them are required. n less than 1 is treated as 1.
+func AckN(n int) AckPolicy {
+	if n < 1 {
+		n = 1
+	}
+	return AckPolicy{
+		n:        n,
+		fraction: 0,
+	}
+}
+
+// AckFraction returns policy to call original ack after the fraction of copies is acked (rounded up).
+// For example, AckFraction(0.5) requires 2 of 3 copies, AckFraction(0.51) requires majority.
+// At least one copy is required. fraction greater than 1 is treated as 1.
+func AckFraction(fraction float64) AckPolicy {
+	if fraction > 1 {
+		fraction = 1
+	}
+	if fraction <= 0 {
+		return AckAny()
+	}
+	return AckPolicy{
+		n:        0,
+		fraction: fraction,
+	}
+}
+
+// isAll returns true if all copies are required, see [AckAll].
+func (p AckPolicy) isAll() bool {
+	return p.n == 0 && p.fraction == 0
+}
+
+// required returns the number of successfully acked copies required to call original ack.
+func (p AckPolicy) required(total int) int {
+	const epsilon = 1e-9 // to compensate float error, e.g. 0.6*5 = 3.0000000000000004
+	required := total
+	switch {
+	case p.n > 0:
+		required = p.n
+	case p.fraction > 0:
+		required = int(math.Ceil(p.fraction*float64(total) - epsilon))
+		if required < 1 {
+			required = 1
+		}
+	}
+	if required > total {
+		required = total
+	}
+	return required
+}
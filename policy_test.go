@@ -0,0 +1,164 @@
+package changroup_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestAckPolicy(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		policy   changroup.AckPolicy
+		total    int
+		required int
+	}{
+		{name: "zero value", policy: changroup.AckPolicy{}, total: 3, required: 3},
+		{name: "all", policy: changroup.AckAll(), total: 3, required: 3},
+		{name: "any", policy: changroup.AckAny(), total: 3, required: 1},
+		{name: "n", policy: changroup.AckN(2), total: 3, required: 2},
+		{name: "n more than total", policy: changroup.AckN(5), total: 3, required: 3},
+		{name: "n less than 1", policy: changroup.AckN(0), total: 3, required: 1},
+		{name: "half", policy: changroup.AckFraction(0.5), total: 3, required: 2},
+		{name: "majority", policy: changroup.AckFraction(0.51), total: 4, required: 3},
+		{name: "exact fraction", policy: changroup.AckFraction(0.6), total: 5, required: 3},
+		{name: "small fraction", policy: changroup.AckFraction(0.01), total: 5, required: 1},
+		{name: "fraction more than 1", policy: changroup.AckFraction(2), total: 3, required: 3},
+		{name: "zero fraction", policy: changroup.AckFraction(0), total: 3, required: 1},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			group := changroup.NewAckableGroup(changroup.WithAckPolicy[int](tc.policy))
+			channels := make([]<-chan changroup.Ackable[int], tc.total)
+			for i := range channels {
+				channels[i], _ = group.Acquire()
+			}
+			done := make(chan struct{})
+			group.SendAsync(changroup.NewAckable(1, func(error) { close(done) }))
+			for i, ch := range channels {
+				if i < tc.required {
+					assertChanBlocked(t, done)
+				}
+				waitChan(t, ch).Ack(nil)
+				if i+1 == tc.required {
+					waitChan(t, done)
+				}
+			}
+		})
+	}
+}
+
+func TestAckableGroupSendWithPolicy(t *testing.T) {
+	t.Parallel()
+	t.Run("overrides group policy", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckPolicy[int](changroup.AckAny()))
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		done := make(chan struct{})
+		go group.SendWithPolicy(changroup.NewAckable(1, func(error) { close(done) }), changroup.AckAll())
+		waitChan(t, ch1).Ack(nil)
+		r2 := waitChan(t, ch2)
+		assertChanBlocked(t, done)
+		r2.Ack(nil)
+		waitChan(t, done)
+	})
+	t.Run("SendAsyncWithPolicy", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		done := make(chan struct{})
+		group.SendAsyncWithPolicy(changroup.NewAckable(1, func(error) { close(done) }), changroup.AckAny())
+		waitChan(t, ch1).Ack(nil)
+		waitChan(t, done)
+		waitChan(t, ch2).Ack(nil) // no effect
+	})
+	t.Run("original ack receives errors resolved before quorum", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckPolicy[int](changroup.AckN(2)))
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		ch3, _ := group.Acquire()
+		ch4, _ := group.Acquire()
+		errTest := errors.New("test")
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch1).Ack(nil)
+		waitChan(t, ch2).Ack(errTest)
+		assertChanBlocked(t, done)
+		waitChan(t, ch3).Ack(nil)
+		err := waitChan(t, done)
+		require.True(t, errors.Is(err, errTest))
+		require.False(t, errors.Is(err, changroup.ErrQuorumNotReached))
+		waitChan(t, ch4).Ack(nil)
+	})
+}
+
+func TestAckPolicyQuorumNotReached(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		policy   changroup.AckPolicy
+		required int
+	}{
+		{name: "any", policy: changroup.AckAny(), required: 1},
+		{name: "n", policy: changroup.AckN(2), required: 2},
+		{name: "majority", policy: changroup.AckFraction(0.51), required: 2},
+	}
+	const total = 3
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("release", func(t *testing.T) {
+				t.Parallel()
+				group := changroup.NewAckableGroup(changroup.WithAckPolicy[int](tc.policy))
+				channels := make([]<-chan changroup.Ackable[int], total)
+				releases := make([]changroup.ReleaseFunc, total)
+				for i := range channels {
+					channels[i], releases[i] = group.Acquire()
+				}
+				done := make(chan error, 1)
+				group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+				for i := 0; i < tc.required-1; i++ {
+					waitChan(t, channels[i]).Ack(nil)
+				}
+				for i := tc.required - 1; i < total-1; i++ {
+					releases[i]()
+					assertChanBlocked(t, done)
+				}
+				releases[total-1]()
+				require.True(t, errors.Is(waitChan(t, done), changroup.ErrQuorumNotReached))
+			})
+			t.Run("dead letter", func(t *testing.T) {
+				t.Parallel()
+				group := changroup.NewAckableGroup(
+					changroup.WithAckPolicy[int](tc.policy),
+					changroup.WithAckDeadline[int](10*time.Millisecond, 0),
+					changroup.WithDeadLetter(func(a changroup.Ackable[int]) { a.Ack(nil) }),
+				)
+				channels := make([]<-chan changroup.Ackable[int], total)
+				for i := range channels {
+					channels[i], _ = group.Acquire()
+				}
+				done := make(chan error, 1)
+				group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+				for i, ch := range channels {
+					a := waitChan(t, ch)
+					if i < tc.required-1 {
+						a.Ack(nil)
+					}
+				}
+				require.True(t, errors.Is(waitChan(t, done), changroup.ErrQuorumNotReached))
+			})
+		})
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package changroup_test
+
+// raceEnabled is true if tests are run with race detector.
+const raceEnabled = true
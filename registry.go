@@ -0,0 +1,63 @@
+package changroup
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// registry is a set of elements optimised for iteration.
+//
+// Readers get an immutable snapshot without locks. Writers copy the snapshot on each removal.
+// Additions append to the spare capacity which is not visible to existing snapshots, so they are amortized O(1).
+// Membership changes never wait for readers and readers never wait for each other.
+type registry[T comparable] struct {
+	mu       sync.Mutex // serializes writers
+	snapshot atomic.Pointer[[]T]
+}
+
+func newRegistry[T comparable]() *registry[T] {
+	r := &registry[T]{
+		mu:       sync.Mutex{},
+		snapshot: atomic.Pointer[[]T]{},
+	}
+	r.snapshot.Store(&[]T{})
+	return r
+}
+
+// Add appends the element to the end of the set.
+func (r *registry[T]) Add(elem T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// writes beyond len of the current snapshot are safe, because all snapshots of the array are not longer
+	elems := append(*r.snapshot.Load(), elem)
+	r.snapshot.Store(&elems)
+}
+
+// Remove removes the element from the set. It does nothing if there is no such element.
+func (r *registry[T]) Remove(elem T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := *r.snapshot.Load()
+	for i, e := range old {
+		if e == elem {
+			elems := make([]T, 0, len(old)-1)
+			elems = append(elems, old[:i]...)
+			elems = append(elems, old[i+1:]...)
+			r.snapshot.Store(&elems)
+			return
+		}
+	}
+}
+
+// RemoveAll removes all elements from the set and returns them.
+func (r *registry[T]) RemoveAll() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.snapshot.Swap(&[]T{})
+}
+
+// Snapshot returns all elements in the order they were added. The returned slice must not be modified.
+// Elements removed after the call are still in the snapshot.
+func (r *registry[T]) Snapshot() []T {
+	return *r.snapshot.Load()
+}
@@ -0,0 +1,78 @@
+package changroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		assert.Empty(t, r.Snapshot())
+	})
+	t.Run("add", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Add(20)
+		r.Add(30)
+		assert.Equal(t, []int{10, 20, 30}, r.Snapshot())
+	})
+	t.Run("remove", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Add(20)
+		r.Add(30)
+		r.Remove(20)
+		assert.Equal(t, []int{10, 30}, r.Snapshot())
+		r.Remove(10)
+		assert.Equal(t, []int{30}, r.Snapshot())
+		r.Remove(30)
+		assert.Empty(t, r.Snapshot())
+	})
+	t.Run("remove missing", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Remove(20)
+		assert.Equal(t, []int{10}, r.Snapshot())
+	})
+	t.Run("snapshot is immutable", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Add(20)
+		snapshot := r.Snapshot()
+		r.Remove(10)
+		r.Add(30)
+		assert.Equal(t, []int{10, 20}, snapshot)
+		assert.Equal(t, []int{20, 30}, r.Snapshot())
+	})
+	t.Run("snapshot is not affected by add", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Add(20)
+		r.Add(30)
+		snapshot := r.Snapshot()
+		r.Add(40)
+		r.Remove(40)
+		r.Add(50)
+		assert.Equal(t, []int{10, 20, 30}, snapshot)
+		assert.Equal(t, []int{10, 20, 30, 50}, r.Snapshot())
+	})
+	t.Run("remove all", func(t *testing.T) {
+		t.Parallel()
+		r := newRegistry[int]()
+		r.Add(10)
+		r.Add(20)
+		assert.Equal(t, []int{10, 20}, r.RemoveAll())
+		assert.Empty(t, r.Snapshot())
+		r.Add(30)
+		assert.Equal(t, []int{30}, r.Snapshot())
+	})
+}
@@ -0,0 +1,564 @@
+package changroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is the result of a copy sent to a remote subscriber which disconnected before acking it,
+// see [NewRemoteAckableServer].
+var ErrDisconnected = errors.New("changroup: remote subscriber is disconnected")
+
+var errRejected = errors.New("changroup: subscription is rejected by server")
+
+const (
+	defaultHeartbeat  = 5 * time.Second
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// RemoteOption configures [RemoteServer] and [RemoteClient].
+type RemoteOption func(*remoteConfig)
+
+type remoteConfig struct {
+	heartbeat    time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	errorHandler func(error)
+}
+
+func newRemoteConfig(options []RemoteOption) remoteConfig {
+	c := remoteConfig{
+		heartbeat:    defaultHeartbeat,
+		minBackoff:   defaultMinBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		errorHandler: nil,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// WithHeartbeat sets the interval of heartbeats. Default is 5 seconds.
+// The connection is closed if nothing is received from the peer during 3 intervals.
+// The server and the client should use the same interval.
+func WithHeartbeat(interval time.Duration) RemoteOption {
+	return func(c *remoteConfig) {
+		c.heartbeat = interval
+	}
+}
+
+// WithReconnectBackoff sets the delay between attempts of [RemoteClient] to reconnect.
+// The delay starts from minDelay and doubles after each failed attempt up to maxDelay.
+// Default is from 100 milliseconds to 5 seconds.
+func WithReconnectBackoff(minDelay, maxDelay time.Duration) RemoteOption {
+	return func(c *remoteConfig) {
+		c.minBackoff = minDelay
+		c.maxBackoff = maxDelay
+	}
+}
+
+// WithRemoteErrorHandler sets the function called for connection and codec errors.
+// By default, such errors are ignored.
+func WithRemoteErrorHandler(handler func(error)) RemoteOption {
+	return func(c *remoteConfig) {
+		c.errorHandler = handler
+	}
+}
+
+// timeout returns how long to wait for anything from the peer.
+func (c *remoteConfig) timeout() time.Duration {
+	return missedHeartbeats * c.heartbeat
+}
+
+func (c *remoteConfig) handleError(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+// remoteError is an error acked by a remote subscriber.
+type remoteError string
+
+func (e remoteError) Error() string {
+	return string(e)
+}
+
+// RemoteServer exposes a [Group] or an [AckableGroup] to [RemoteClient] over network.
+//
+// Each connection acquires its own channel from the group, so it receives values like a local subscriber.
+// The channel is released when the connection is closed.
+type RemoteServer[T any] struct {
+	group     *Group[T]
+	ackable   *AckableGroup[T]
+	codec     Codec[T]
+	config    remoteConfig
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	handlers  sync.WaitGroup
+}
+
+// NewRemoteServer creates a server for the group. Use [RemoteServer.Serve] to accept connections.
+func NewRemoteServer[T any](group *Group[T], codec Codec[T], options ...RemoteOption) *RemoteServer[T] {
+	return newRemoteServer(group, nil, codec, options)
+}
+
+// NewRemoteAckableServer creates a server for the ackable group. Clients must use [RemoteClient.AcquireAckable].
+//
+// A copy is acked when the client acks it. Copies which are not acked when the connection is closed are resolved
+// according to [ReleasePolicy] of the group, or acked with [ErrDisconnected] if the group waits for ack.
+func NewRemoteAckableServer[T any](group *AckableGroup[T], codec Codec[T], options ...RemoteOption) *RemoteServer[T] {
+	return newRemoteServer(nil, group, codec, options)
+}
+
+func newRemoteServer[T any](
+	group *Group[T], ackable *AckableGroup[T], codec Codec[T], options []RemoteOption,
+) *RemoteServer[T] {
+	return &RemoteServer[T]{
+		group:     group,
+		ackable:   ackable,
+		codec:     codec,
+		config:    newRemoteConfig(options),
+		mu:        sync.Mutex{},
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+		closed:    false,
+		handlers:  sync.WaitGroup{},
+	}
+}
+
+// Serve accepts connections on the listener until it fails or [RemoteServer.Close] is called.
+// It returns [ErrClosed] after Close. It's safe to serve several listeners at the same time.
+func (s *RemoteServer[T]) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, listener)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return ErrClosed
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("changroup: accept connection: %w", err)
+		}
+		s.conns[conn] = struct{}{}
+		s.handlers.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.handlers.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close closes all listeners and connections and waits until their channels are released.
+// It's safe to call Close several times.
+func (s *RemoteServer[T]) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for listener := range s.listeners {
+		if closeErr := listener.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("changroup: close listener: %w", closeErr)
+		}
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.handlers.Wait()
+	return err
+}
+
+func (s *RemoteServer[T]) serveConn(conn net.Conn) {
+	c := newRemoteConn(conn)
+	defer func() { _ = conn.Close() }()
+	kind, payload, err := c.read(s.config.timeout())
+	if err != nil {
+		s.config.handleError(err)
+		return
+	}
+	const helloSize = 2
+	if kind != frameHello || len(payload) != helloSize || payload[0] != remoteVersion {
+		_ = c.write(frameError, []byte("unsupported protocol"))
+		return
+	}
+	if (payload[1] == 1) != (s.ackable != nil) {
+		_ = c.write(frameError, []byte("subscription kind mismatch"))
+		return
+	}
+
+	acks := newPendingAcks()
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(2) //nolint:mnd // heartbeat and reader
+	go func() {
+		defer wg.Done()
+		c.heartbeat(s.config.heartbeat, stop)
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(readerDone)
+		defer func() { _ = conn.Close() }() // unblocks writes if the peer is dead
+		s.readAcks(c, acks)
+	}()
+	if s.ackable != nil {
+		s.sendAckable(c, acks, readerDone)
+	} else {
+		s.sendValues(c, readerDone)
+	}
+	close(stop)
+	_ = conn.Close() // stops reader
+	wg.Wait()
+	acks.failAll(ErrDisconnected)
+}
+
+// sendValues writes values sent to the group until the connection is broken.
+func (s *RemoteServer[T]) sendValues(c *remoteConn, readerDone <-chan struct{}) {
+	ch, release := s.group.Acquire()
+	defer release()
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := s.codec.Encode(value)
+			if err != nil {
+				s.config.handleError(fmt.Errorf("changroup: encode value: %w", err))
+				continue
+			}
+			if err := c.write(frameValue, data); err != nil {
+				s.config.handleError(err)
+				return
+			}
+		case <-readerDone:
+			return
+		}
+	}
+}
+
+// sendAckable is like sendValues, but for ackable group.
+func (s *RemoteServer[T]) sendAckable(c *remoteConn, acks *pendingAcks, readerDone <-chan struct{}) {
+	ch, release := s.ackable.Acquire()
+	defer release()
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := s.codec.Encode(value.Value)
+			if err != nil {
+				err = fmt.Errorf("changroup: encode value: %w", err)
+				s.config.handleError(err)
+				value.Ack(err)
+				continue
+			}
+			id := acks.add(value.Ack)
+			if err := c.write(frameAckable, encodeID(id), data); err != nil {
+				s.config.handleError(err)
+				return
+			}
+		case <-readerDone:
+			return
+		}
+	}
+}
+
+// readAcks reads frames from the client until the connection is broken.
+func (s *RemoteServer[T]) readAcks(c *remoteConn, acks *pendingAcks) {
+	for {
+		kind, payload, err := c.read(s.config.timeout())
+		if err == nil {
+			switch kind {
+			case framePing:
+				continue
+			case frameAck:
+				var id uint64
+				if id, payload, err = decodeID(payload); err == nil {
+					acks.ack(id, payload)
+					continue
+				}
+			default:
+				err = fmt.Errorf("%w: %d", errUnexpectedFrame, kind)
+			}
+		}
+		if !closedConnError(err) {
+			s.config.handleError(err)
+		}
+		return
+	}
+}
+
+// pendingAcks holds ack functions of copies sent to a remote subscriber.
+type pendingAcks struct {
+	mu   sync.Mutex
+	last uint64
+	acks map[uint64]func(error)
+}
+
+func newPendingAcks() *pendingAcks {
+	return &pendingAcks{
+		mu:   sync.Mutex{},
+		last: 0,
+		acks: map[uint64]func(error){},
+	}
+}
+
+// add returns the id of the copy.
+func (p *pendingAcks) add(ack func(error)) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last++
+	p.acks[p.last] = ack
+	return p.last
+}
+
+// ack calls the ack function of the copy with the error message received from the client.
+func (p *pendingAcks) ack(id uint64, message []byte) {
+	p.mu.Lock()
+	ack, ok := p.acks[id]
+	delete(p.acks, id)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	if len(message) == 0 {
+		ack(nil)
+	} else {
+		ack(remoteError(message))
+	}
+}
+
+// failAll calls all ack functions with the error.
+func (p *pendingAcks) failAll(err error) {
+	p.mu.Lock()
+	acks := p.acks
+	p.acks = map[uint64]func(error){}
+	p.mu.Unlock()
+	for _, ack := range acks {
+		ack(err)
+	}
+}
+
+// RemoteClient subscribes to a [RemoteServer].
+type RemoteClient[T any] struct {
+	network string
+	address string
+	codec   Codec[T]
+	config  remoteConfig
+}
+
+// NewRemoteClient creates a client of the server listening on the address, see [net.Dial].
+// It doesn't connect until a channel is acquired.
+func NewRemoteClient[T any](network, address string, codec Codec[T], options ...RemoteOption) *RemoteClient[T] {
+	return &RemoteClient[T]{
+		network: network,
+		address: address,
+		codec:   codec,
+		config:  newRemoteConfig(options),
+	}
+}
+
+// Acquire connects to the server of [Group] and returns a channel receiving values sent to the group.
+// The connection is restored automatically if it's broken, values sent in the meantime are missed.
+// Values which can't be decoded are skipped.
+//
+// [ReleaseFunc] is returned as the second value.
+// It should be called to close the connection and the channel. It's safe to call [ReleaseFunc] several times.
+// The channel is closed without release if the server rejects the subscription.
+func (c *RemoteClient[T]) Acquire() (<-chan T, ReleaseFunc) {
+	out := make(chan T)
+	release := c.subscribe(false, func(value T, _ func(error), done <-chan struct{}) bool {
+		select {
+		case out <- value:
+			return true
+		case <-done:
+			return false
+		}
+	}, func() { close(out) })
+	return out, release
+}
+
+// AcquireAckable is like [RemoteClient.Acquire], but for the server of [AckableGroup].
+// Acks are sent back to the server. Acks of values received before reconnect have no effect.
+// Values which can't be decoded are acked with the decoding error.
+func (c *RemoteClient[T]) AcquireAckable() (<-chan Ackable[T], ReleaseFunc) {
+	out := make(chan Ackable[T])
+	release := c.subscribe(true, func(value T, ack func(error), done <-chan struct{}) bool {
+		select {
+		case out <- NewAckable(value, ack):
+			return true
+		case <-done:
+			return false
+		}
+	}, func() { close(out) })
+	return out, release
+}
+
+// subscribe connects to the server and passes received values to deliver until release.
+// The deliver should return false if done is closed.
+func (c *RemoteClient[T]) subscribe(
+	ackable bool,
+	deliver func(value T, ack func(error), done <-chan struct{}) bool,
+	finish func(),
+) ReleaseFunc {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer finish()
+		backoff := c.config.minBackoff
+		for {
+			connected, err := c.session(ackable, deliver, done)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			c.config.handleError(err)
+			if errors.Is(err, errRejected) {
+				return
+			}
+			if connected {
+				backoff = c.config.minBackoff
+			}
+			select {
+			case <-time.After(backoff):
+			case <-done:
+				return
+			}
+			backoff *= 2
+			if backoff > c.config.maxBackoff {
+				backoff = c.config.maxBackoff
+			}
+		}
+	}()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// session connects to the server and receives values until the connection is broken or done is closed.
+// It returns true if connected successfully.
+func (c *RemoteClient[T]) session(
+	ackable bool,
+	deliver func(value T, ack func(error), done <-chan struct{}) bool,
+	done <-chan struct{},
+) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	defer close(stop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-done:
+			cancel()
+		case <-stop:
+			cancel()
+		}
+	}()
+	dialer := net.Dialer{Timeout: c.config.timeout()} //nolint:exhaustruct // default values are fine
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return false, fmt.Errorf("changroup: connect: %w", err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		_ = conn.Close() // unblocks read
+	}()
+
+	rc := newRemoteConn(conn)
+	hello := []byte{remoteVersion, 0}
+	if ackable {
+		hello[1] = 1
+	}
+	if err := rc.write(frameHello, hello); err != nil {
+		return true, err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rc.heartbeat(c.config.heartbeat, stop)
+	}()
+
+	for {
+		kind, payload, err := rc.read(c.config.timeout())
+		if err != nil {
+			return true, err
+		}
+		var id uint64
+		switch {
+		case kind == framePing:
+			continue
+		case kind == frameError:
+			return true, fmt.Errorf("%w: %s", errRejected, payload)
+		case kind == frameValue && !ackable:
+		case kind == frameAckable && ackable:
+			if id, payload, err = decodeID(payload); err != nil {
+				return true, err
+			}
+		default:
+			return true, fmt.Errorf("%w: %d", errUnexpectedFrame, kind)
+		}
+		var ack func(error)
+		if ackable {
+			ack = func(err error) {
+				message := ""
+				if err != nil {
+					message = err.Error()
+				}
+				_ = rc.write(frameAck, encodeID(id), []byte(message)) // the server fails the copy if it's broken
+			}
+		}
+		value, err := c.codec.Decode(payload)
+		if err != nil {
+			err = fmt.Errorf("changroup: decode value: %w", err)
+			c.config.handleError(err)
+			if ack != nil {
+				ack(err)
+			}
+			continue
+		}
+		if !deliver(value, ack, done) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package changroup_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestRemote(t *testing.T) {
+	t.Parallel()
+	networks := map[string]func(t *testing.T) net.Listener{
+		"tcp": func(t *testing.T) net.Listener {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			return l
+		},
+		"unix": func(t *testing.T) net.Listener {
+			l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+			require.NoError(t, err)
+			return l
+		},
+	}
+	for name, listen := range networks {
+		listen := listen
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("client receives values", func(t *testing.T) {
+				t.Parallel()
+				group := changroup.NewGroup[int]()
+				l := listen(t)
+				serve(t, changroup.NewRemoteServer[int](group, changroup.JSONCodec[int]{}), l)
+				client := changroup.NewRemoteClient[int](l.Addr().Network(), l.Addr().String(), changroup.JSONCodec[int]{})
+				ch, release := client.Acquire()
+				waitSubscribed(t, group, ch)
+				go func() {
+					for i := 1; i <= 3; i++ {
+						group.Send(i)
+					}
+				}()
+				for i := 1; i <= 3; i++ {
+					require.Equal(t, i, waitNonZero(t, ch))
+				}
+				release()
+				release()
+				assertChanClosed(t, ch)
+			})
+			t.Run("acks are sent to server", func(t *testing.T) {
+				t.Parallel()
+				group := changroup.NewAckableGroup[int]()
+				l := listen(t)
+				serve(t, changroup.NewRemoteAckableServer[int](group, changroup.GobCodec[int]{}), l)
+				client := changroup.NewRemoteClient[int](l.Addr().Network(), l.Addr().String(), changroup.GobCodec[int]{})
+				ch, release := client.AcquireAckable()
+				defer release()
+				waitSubscribedAckable(t, group, ch)
+
+				acks := make(chan error, 2)
+				go group.Send(changroup.NewAckable(1, func(err error) { acks <- err }))
+				v := waitNonZeroAckable(t, ch)
+				require.Equal(t, 1, v.Value)
+				v.Ack(nil)
+				require.NoError(t, waitRemote(t, acks))
+
+				go group.Send(changroup.NewAckable(2, func(err error) { acks <- err }))
+				waitNonZeroAckable(t, ch).Ack(errors.New("boom"))
+				err := waitRemote(t, acks)
+				require.Error(t, err)
+				require.Equal(t, "boom", err.Error())
+			})
+		})
+	}
+	t.Run("not acked values are failed on disconnect", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		l := listen(t)
+		serve(t, changroup.NewRemoteAckableServer[int](group, changroup.JSONCodec[int]{}), l)
+		client := changroup.NewRemoteClient[int]("tcp", l.Addr().String(), changroup.JSONCodec[int]{})
+		ch, release := client.AcquireAckable()
+		waitSubscribedAckable(t, group, ch)
+		acks := make(chan error, 1)
+		go group.Send(changroup.NewAckable(1, func(err error) { acks <- err }))
+		require.Equal(t, 1, waitNonZeroAckable(t, ch).Value)
+		release()
+		require.True(t, errors.Is(waitRemote(t, acks), changroup.ErrDisconnected))
+	})
+	t.Run("client reconnects", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		l := listen(t)
+		server := changroup.NewRemoteServer[int](group, changroup.JSONCodec[int]{})
+		go func() { _ = server.Serve(l) }()
+		client := changroup.NewRemoteClient[int]("tcp", l.Addr().String(), changroup.JSONCodec[int]{},
+			changroup.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond))
+		ch, release := client.Acquire()
+		defer release()
+		waitSubscribed(t, group, ch)
+		require.NoError(t, server.Close())
+		require.Equal(t, changroup.ErrClosed, server.Serve(l))
+
+		l2, err := net.Listen("tcp", l.Addr().String())
+		require.NoError(t, err)
+		serve(t, changroup.NewRemoteServer[int](group, changroup.JSONCodec[int]{}), l2)
+		waitSubscribed(t, group, ch)
+	})
+	t.Run("server rejects wrong subscription kind", func(t *testing.T) {
+		t.Parallel()
+		l := listen(t)
+		serve(t, changroup.NewRemoteAckableServer[int](changroup.NewAckableGroup[int](), changroup.JSONCodec[int]{}), l)
+		errs := make(chan error, 1)
+		client := changroup.NewRemoteClient[int]("tcp", l.Addr().String(), changroup.JSONCodec[int]{},
+			changroup.WithRemoteErrorHandler(func(err error) { errs <- err }))
+		ch, release := client.Acquire()
+		defer release()
+		require.Contains(t, waitRemote(t, errs).Error(), "subscription kind mismatch")
+		require.Zero(t, waitRemote(t, ch))
+		assertChanClosed(t, ch)
+	})
+	t.Run("server detects dead client by heartbeats", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[string]()
+		l := listen(t)
+		serve(t, changroup.NewRemoteServer[string](group, changroup.JSONCodec[string]{},
+			changroup.WithHeartbeat(50*time.Millisecond)), l)
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		_, err = conn.Write([]byte{1, 0, 0, 0, 2, 1, 0}) // hello and nothing more, the client neither reads nor pings
+		require.NoError(t, err)
+		probed := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-probed:
+					return
+				case <-time.After(time.Millisecond):
+					group.Send("")
+				}
+			}
+		}()
+		// read until the first value to be sure the server is subscribed
+		header := make([]byte, 5)
+		for header[0] != 2 {
+			_, err = io.ReadFull(conn, header)
+			require.NoError(t, err)
+			_, err = io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint32(header[1:])))
+			require.NoError(t, err)
+		}
+		close(probed)
+		value := strings.Repeat("x", 1<<16)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ { // enough to fill socket buffers
+				group.Send(value)
+			}
+		}()
+		waitRemote(t, done)
+	})
+	t.Run("slow client is not disconnected", func(t *testing.T) {
+		t.Parallel()
+		const heartbeat = 200 * time.Millisecond // pings must not be missed under load, only reads of values stall
+		group := changroup.NewGroup[string]()
+		l := listen(t)
+		serve(t, changroup.NewRemoteServer[string](group, changroup.JSONCodec[string]{},
+			changroup.WithHeartbeat(heartbeat)), l)
+		errs := make(chan error, 1)
+		client := changroup.NewRemoteClient[string]("tcp", l.Addr().String(), changroup.JSONCodec[string]{},
+			changroup.WithHeartbeat(heartbeat),
+			changroup.WithRemoteErrorHandler(func(err error) {
+				select {
+				case errs <- err:
+				default:
+				}
+			}))
+		ch, release := client.Acquire()
+		defer release()
+		stop := sendUntilStopped(func() { group.Send("") })
+		waitRemote(t, ch)
+		stop()
+		value := strings.Repeat("x", 1<<16)
+		const n = 200 // enough to fill socket buffers
+		go func() {
+			for i := 0; i < n; i++ {
+				group.Send(value + strconv.Itoa(i))
+			}
+		}()
+		time.Sleep(5 * heartbeat) // longer than the timeout, the client doesn't read, but it's alive
+		for i := 0; i < n; i++ {
+			v := waitRemote(t, ch)
+			for v == "" { // sent by sendUntilStopped
+				v = waitRemote(t, ch)
+			}
+			require.Equal(t, value+strconv.Itoa(i), v)
+		}
+		assertChanBlocked(t, errs)
+	})
+	t.Run("client detects dead server by heartbeats", func(t *testing.T) {
+		t.Parallel()
+		l := listen(t)
+		go func() {
+			for {
+				conn, err := l.Accept() // never responds
+				if err != nil {
+					return
+				}
+				t.Cleanup(func() { _ = conn.Close() })
+			}
+		}()
+		t.Cleanup(func() { _ = l.Close() })
+		errs := make(chan error, 10)
+		client := changroup.NewRemoteClient[int]("tcp", l.Addr().String(), changroup.JSONCodec[int]{},
+			changroup.WithHeartbeat(10*time.Millisecond),
+			changroup.WithRemoteErrorHandler(func(err error) {
+				select {
+				case errs <- err:
+				default:
+				}
+			}))
+		_, release := client.Acquire()
+		defer release()
+		var netErr net.Error
+		require.True(t, errors.As(waitRemote(t, errs), &netErr))
+		require.True(t, netErr.Timeout())
+	})
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return l
+}
+
+// serve runs the server until the end of the test.
+func serve[T any](t *testing.T, server *changroup.RemoteServer[T], l net.Listener) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Equal(t, changroup.ErrClosed, server.Serve(l))
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, server.Close())
+		<-done
+	})
+}
+
+// remoteTimeout is how long remote tests wait for a value. Round trips over network may be slow
+// when other tests load CPU, so it's much longer than the timeout of waitChan.
+const remoteTimeout = 30 * time.Second
+
+// waitRemote is like waitChan, but with remoteTimeout.
+func waitRemote[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(remoteTimeout):
+		require.Fail(t, "timeout")
+		panic("")
+	}
+}
+
+// waitSubscribed sends zeros until the remote channel receives one.
+func waitSubscribed(t *testing.T, group *changroup.Group[int], ch <-chan int) {
+	t.Helper()
+	stop := sendUntilStopped(func() { group.Send(0) })
+	defer stop()
+	waitRemote(t, ch)
+}
+
+// waitSubscribedAckable sends zeros until the remote channel receives one and the server receives its ack.
+func waitSubscribedAckable(t *testing.T, group *changroup.AckableGroup[int], ch <-chan changroup.Ackable[int]) {
+	t.Helper()
+	acked := make(chan struct{}, 1)
+	stop := sendUntilStopped(func() {
+		group.Send(changroup.NewAckable(0, func(error) {
+			select {
+			case acked <- struct{}{}:
+			default:
+			}
+		}))
+	})
+	defer stop()
+	waitRemote(t, ch).Ack(nil)
+	waitRemote(t, acked)
+}
+
+// sendUntilStopped calls send in background until the returned stop function is called.
+// Stop waits for the last send to return.
+func sendUntilStopped(send func()) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			send()
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// waitNonZero skips zeros sent by waitSubscribed.
+func waitNonZero(t *testing.T, ch <-chan int) int {
+	t.Helper()
+	for {
+		if v := waitRemote(t, ch); v != 0 {
+			return v
+		}
+	}
+}
+
+// waitNonZeroAckable skips zeros sent by waitSubscribedAckable.
+func waitNonZeroAckable(t *testing.T, ch <-chan changroup.Ackable[int]) changroup.Ackable[int] {
+	t.Helper()
+	for {
+		if v := waitRemote(t, ch); v.Value != 0 {
+			return v
+		}
+	}
+}
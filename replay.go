@@ -0,0 +1,62 @@
+package changroup
+
+import "sync"
+
+// replay is a channel which receives a backlog of values first and then live values.
+type replay struct {
+	release ReleaseFunc
+}
+
+// acquireReplay creates a channel which receives values sent by backlog and then values from live channel.
+// The backlog should return false if done is closed. Live values are converted by convert,
+// they are dropped if it returns false. The replay is added to replays until it's released.
+func acquireReplay[T, L any](
+	replays *registry[*replay],
+	live <-chan L,
+	releaseLive ReleaseFunc,
+	backlog func(out chan<- T, done <-chan struct{}) bool,
+	convert func(value L) (T, bool),
+) (<-chan T, ReleaseFunc) {
+	out := make(chan T)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer close(out)
+		if !backlog(out, done) {
+			return
+		}
+		for {
+			select {
+			case received, ok := <-live:
+				if !ok {
+					return
+				}
+				value, ok := convert(received)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- value:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	r := &replay{release: nil}
+	once := sync.Once{}
+	r.release = func() {
+		once.Do(func() {
+			replays.Remove(r)
+			close(done)
+			releaseLive()
+			<-finished
+		})
+	}
+	replays.Add(r)
+	return out, r.release
+}
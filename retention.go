@@ -0,0 +1,143 @@
+package changroup
+
+import "time"
+
+// Sizer returns the size of a value in bytes, see [WithMaxBytes].
+type Sizer[T any] interface {
+	Size(value T) int
+}
+
+// SizerFunc is an adapter to use an ordinary function as [Sizer].
+type SizerFunc[T any] func(value T) int
+
+// Size returns f(value).
+func (f SizerFunc[T]) Size(value T) int {
+	return f(value)
+}
+
+// CodecSizer returns [Sizer] which measures the size of encoded value. A value which can't be encoded has zero size.
+func CodecSizer[T any](codec Codec[T]) Sizer[T] {
+	return SizerFunc[T](func(value T) int {
+		data, err := codec.Encode(value)
+		if err != nil {
+			return 0
+		}
+		return len(data)
+	})
+}
+
+// WithMaxEntries limits the number of retained values. The oldest values are evicted first.
+// By default, the number is not limited.
+func WithMaxEntries[T any](n int) LogGroupOption[T] {
+	return func(c *logGroupConfig[T]) {
+		c.maxEntries = n
+	}
+}
+
+// WithMaxAge evicts values retained longer than the duration. By default, the age is not limited.
+func WithMaxAge[T any](age time.Duration) LogGroupOption[T] {
+	return func(c *logGroupConfig[T]) {
+		c.maxAge = age
+	}
+}
+
+// WithMaxBytes limits the total size of retained values measured by sizer. The oldest values are evicted first.
+// By default, the size is not limited. See also [CodecSizer].
+func WithMaxBytes[T any](n int, sizer Sizer[T]) LogGroupOption[T] {
+	return func(c *logGroupConfig[T]) {
+		c.maxBytes = n
+		c.sizer = sizer
+	}
+}
+
+// retained is an entry retained by [LogGroup].
+type retained[T any] struct {
+	entry Entry[T]
+	at    time.Time // when the entry was sent
+	size  int       // size measured by sizer, zero if there is no sizer
+	// tombstone and removed are used by compaction, see [WithCompaction]
+	tombstone bool
+	removed   bool // a newer value with the same key is sent, only offset is kept
+}
+
+// limited returns true if any retention limit is set.
+func (c *logGroupConfig[T]) limited() bool {
+	return c.maxEntries > 0 || c.maxAge > 0 || (c.maxBytes > 0 && c.sizer != nil) || c.tombstoneAge > 0
+}
+
+// trimLoop evicts values violating retention limits until Close is called.
+// It's woken up by Send and by expiration of the oldest value.
+func (g *LogGroup[T]) trimLoop() {
+	defer g.stopped.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		expiresIn, expires := g.trim(time.Now())
+		var expired <-chan time.Time
+		if expires {
+			timer.Reset(expiresIn)
+			expired = timer.C
+		}
+		select {
+		case <-g.wake:
+		case <-expired:
+		case <-g.stop:
+			return
+		}
+		if expires && !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// trim evicts values violating retention limits and expired tombstones.
+// It returns the time until the next value expires and false if there is no such value.
+func (g *LogGroup[T]) trim(now time.Time) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.entries) > 0 {
+		oldest := g.entries[0]
+		if !oldest.removed && !g.exceeds(len(g.entries)-g.holes, now.Sub(oldest.at)) {
+			break
+		}
+		g.evictOldest()
+	}
+	expiresIn, expires := g.expireTombstones(now)
+	if g.config.maxAge <= 0 || len(g.entries) == 0 {
+		return expiresIn, expires
+	}
+	if oldest := g.config.maxAge - now.Sub(g.entries[0].at); !expires || oldest < expiresIn {
+		return oldest, true
+	}
+	return expiresIn, true
+}
+
+// evictOldest removes the first entry. It must be called under lock.
+func (g *LogGroup[T]) evictOldest() {
+	var zero retained[T]
+	oldest := g.entries[0]
+	if oldest.removed {
+		g.holes--
+	} else {
+		g.bytes -= oldest.size
+		if g.keys != nil {
+			g.keys.delete(oldest.entry.Value)
+		}
+	}
+	g.entries[0] = zero // don't retain evicted value
+	g.entries = g.entries[1:]
+	if len(g.entries) == 0 {
+		g.entries = nil // release the array
+	}
+}
+
+// exceeds returns true if the oldest value must be evicted. It must be called under lock.
+func (g *LogGroup[T]) exceeds(count int, age time.Duration) bool {
+	return (g.config.maxEntries > 0 && count > g.config.maxEntries) ||
+		(g.config.maxAge > 0 && age >= g.config.maxAge) ||
+		(g.config.maxBytes > 0 && g.bytes > g.config.maxBytes)
+}
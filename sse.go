@@ -0,0 +1,151 @@
+package changroup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// SSEHandler streams values sent to a group as Server-Sent Events. Each request acquires its own channel,
+// it's released when the client disconnects. Each value is encoded by the codec and flushed as a separate event.
+type SSEHandler[T any] struct {
+	group  *Group[T]
+	log    *LogGroup[T]
+	codec  Codec[T]
+	config httpConfig
+}
+
+// NewSSEHandler creates a handler streaming values sent to the group after the request.
+func NewSSEHandler[T any](group *Group[T], codec Codec[T], options ...HTTPOption) *SSEHandler[T] {
+	return &SSEHandler[T]{
+		group:  group,
+		log:    nil,
+		codec:  codec,
+		config: newHTTPConfig(options),
+	}
+}
+
+// NewLogSSEHandler creates a handler for [LogGroup]. Offsets of values are used as event IDs.
+//
+// If the request has Last-Event-ID header (e.g. EventSource reconnects), the stream is resumed
+// from the next retained value, see [LogGroup.AcquireFrom]. It responds with 410 Gone if the value is evicted
+// and with 400 Bad Request if the ID is not valid. Without the header, only new values are streamed.
+func NewLogSSEHandler[T any](group *LogGroup[T], codec Codec[T], options ...HTTPOption) *SSEHandler[T] {
+	return &SSEHandler[T]{
+		group:  nil,
+		log:    group,
+		codec:  codec,
+		config: newHTTPConfig(options),
+	}
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *SSEHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.group != nil {
+		ch, release := h.group.Acquire()
+		defer release()
+		streamSSE(h, w, r, ch, func(value T) (string, T) { return "", value })
+		return
+	}
+	ch, release, status, err := h.acquireLog(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer release()
+	streamSSE(h, w, r, ch, func(entry Entry[T]) (string, T) {
+		return strconv.FormatUint(entry.Offset, 10), entry.Value
+	})
+}
+
+// acquireLog acquires a channel from the log starting after the last event ID.
+// It returns HTTP status code if it fails.
+func (h *SSEHandler[T]) acquireLog(lastEventID string) (<-chan Entry[T], ReleaseFunc, int, error) {
+	if lastEventID == "" {
+		ch, release := h.log.Acquire()
+		return ch, release, 0, nil
+	}
+	last, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID: %w", err)
+	}
+	if last == math.MaxUint64 {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("%w: %d", ErrOffsetOutOfRange, last)
+	}
+	ch, release, err := h.log.AcquireFrom(last + 1)
+	if errors.Is(err, ErrOffsetEvicted) {
+		return nil, nil, http.StatusGone, err
+	}
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	return ch, release, 0, nil
+}
+
+// streamSSE writes values received from the channel until the client disconnects or the channel is closed.
+// The event function returns the event ID (may be empty) and the value of the item.
+func streamSSE[T, E any](
+	h *SSEHandler[T], w http.ResponseWriter, r *http.Request, ch <-chan E, event func(E) (string, T),
+) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		h.config.handleError(fmt.Errorf("changroup: flush SSE response: %w", err))
+		return
+	}
+	var buf bytes.Buffer
+	for {
+		select {
+		case item, ok := <-ch:
+			if !ok {
+				return
+			}
+			id, value := event(item)
+			data, err := h.codec.Encode(value)
+			if err != nil {
+				h.config.handleError(fmt.Errorf("changroup: encode value: %w", err))
+				continue
+			}
+			buf.Reset()
+			writeSSEEvent(&buf, id, data)
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return // the client is gone
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSEEvent formats the event. Each line of data is written as a separate data field.
+func writeSSEEvent(buf *bytes.Buffer, id string, data []byte) {
+	if id != "" {
+		buf.WriteString("id: ")
+		buf.WriteString(id)
+		buf.WriteByte('\n')
+	}
+	for {
+		line, rest, found := bytes.Cut(data, []byte{'\n'})
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte{'\r'}))
+		buf.WriteByte('\n')
+		if !found {
+			break
+		}
+		data = rest
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,182 @@
+package changroup_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestSSEHandler(t *testing.T) {
+	t.Parallel()
+	t.Run("streams values", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[string]()
+		server := httptest.NewServer(changroup.NewSSEHandler[string](group, changroup.JSONCodec[string]{}))
+		defer server.Close()
+		resp, events := getSSE(t, context.Background(), server.URL, "")
+		defer resp.Body.Close()
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		go func() {
+			group.Send("a")
+			group.Send("b")
+		}()
+		require.Equal(t, "data: \"a\"\n", waitChan(t, events))
+		require.Equal(t, "data: \"b\"\n", waitChan(t, events))
+	})
+	t.Run("multiline data", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[[]byte]()
+		server := httptest.NewServer(changroup.NewSSEHandler[[]byte](group, rawCodec{}))
+		defer server.Close()
+		resp, events := getSSE(t, context.Background(), server.URL, "")
+		defer resp.Body.Close()
+		go group.Send([]byte("line1\r\nline2\n"))
+		require.Equal(t, "data: line1\ndata: line2\ndata: \n", waitChan(t, events))
+	})
+	t.Run("releases channel when client disconnects", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[string]()
+		server := httptest.NewServer(changroup.NewSSEHandler[string](group, changroup.JSONCodec[string]{}))
+		defer server.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		resp, events := getSSE(t, ctx, server.URL, "")
+		defer resp.Body.Close()
+		go group.Send("a")
+		waitChan(t, events)
+		cancel()
+		waitCondition(t, func() bool {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				group.Send("b") // blocks until the channel is released
+			}()
+			select {
+			case <-done:
+				return true
+			case <-time.After(10 * time.Millisecond):
+				return false
+			}
+		})
+	})
+	t.Run("rejects not GET", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[string]()
+		server := httptest.NewServer(changroup.NewSSEHandler[string](group, changroup.JSONCodec[string]{}))
+		defer server.Close()
+		resp, err := http.Post(server.URL, "text/plain", nil) //nolint:noctx // test
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestLogSSEHandler(t *testing.T) {
+	t.Parallel()
+	newServer := func(group *changroup.LogGroup[int]) *httptest.Server {
+		return httptest.NewServer(changroup.NewLogSSEHandler[int](group, changroup.JSONCodec[int]{}))
+	}
+	t.Run("streams new values with ids", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.Close()
+		group.Send(10)
+		server := newServer(group)
+		defer server.Close()
+		resp, events := getSSE(t, context.Background(), server.URL, "")
+		defer resp.Body.Close()
+		go group.Send(11)
+		require.Equal(t, "id: 1\ndata: 11\n", waitChan(t, events))
+	})
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.Close()
+		for i := 0; i < 3; i++ {
+			group.Send(i * 10)
+		}
+		server := newServer(group)
+		defer server.Close()
+		resp, events := getSSE(t, context.Background(), server.URL, "0")
+		defer resp.Body.Close()
+		require.Equal(t, "id: 1\ndata: 10\n", waitChan(t, events))
+		require.Equal(t, "id: 2\ndata: 20\n", waitChan(t, events))
+		go group.Send(30)
+		require.Equal(t, "id: 3\ndata: 30\n", waitChan(t, events))
+	})
+	t.Run("evicted Last-Event-ID", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int](changroup.WithMaxEntries[int](1))
+		defer group.Close()
+		group.Send(0)
+		group.Send(1)
+		group.Send(2)
+		waitEarliest(t, group, 2)
+		server := newServer(group)
+		defer server.Close()
+		resp, _ := getSSE(t, context.Background(), server.URL, "0")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusGone, resp.StatusCode)
+	})
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewLogGroup[int]()
+		defer group.Close()
+		server := newServer(group)
+		defer server.Close()
+		for _, id := range []string{"abc", "5", "18446744073709551615"} {
+			resp, _ := getSSE(t, context.Background(), server.URL, id)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, id)
+			resp.Body.Close()
+		}
+	})
+}
+
+// getSSE starts the request and returns the channel of received events.
+func getSSE(t *testing.T, ctx context.Context, url, lastEventID string) (*http.Response, <-chan string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	events := make(chan string, 100) // reader must not stuck if the test stops reading
+	go func() {
+		defer close(events)
+		r := bufio.NewReader(resp.Body)
+		var event strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "\n" {
+				events <- event.String()
+				event.Reset()
+				continue
+			}
+			event.WriteString(line)
+		}
+	}()
+	return resp, events
+}
+
+// rawCodec passes bytes as is.
+type rawCodec struct{}
+
+func (rawCodec) Encode(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (rawCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,346 @@
+package changroup
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// SubscriberOption configures a channel acquired from [AckableGroup], see [AckableGroup.Acquire].
+type SubscriberOption func(*subscriberConfig)
+
+type subscriberConfig struct {
+	maxInFlight int
+	overflow    OverflowPolicy
+}
+
+// OverflowPolicy defines what happens with a value that can't be delivered immediately because of a limit.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes publisher wait until the value can be delivered.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowBuffer makes publisher put the value to an unbounded queue and return immediately.
+	// Values from the queue are delivered in the same order as they were sent.
+	OverflowBuffer
+)
+
+// WithMaxInFlight limits the number of received but not yet acked copies the subscriber may hold.
+//
+// Further copies are held back until earlier ones are acked (or resolved in another way, see [AckReport]).
+// Publisher either waits for it or buffers copies depending on overflow policy.
+// A copy which is not acked within deadline (see [WithAckDeadline]) gives its slot back,
+// and the redelivered copy waits for a slot like a new one.
+// maxInFlight less than 1 means no limit.
+func WithMaxInFlight(maxInFlight int, overflow OverflowPolicy) SubscriberOption {
+	return func(c *subscriberConfig) {
+		c.maxInFlight = maxInFlight
+		c.overflow = overflow
+	}
+}
+
+// subscriber is a channel acquired from [AckableGroup].
+type subscriber[T any] struct {
+	*channel[Ackable[T]]
+	id       SubscriberID
+	stack    string // stack trace of acquire, is used only for leak detection
+	overflow OverflowPolicy
+	slots    chan struct{}      // limits number of in-flight copies, nil if there is no limit
+	buffer   fifo[*delivery[T]] // copies waiting for a slot if overflow policy is OverflowBuffer
+
+	outstandingMu sync.Mutex
+	outstanding   map[*delivery[T]]uint64 // received but not acked copies with seq of message, see ReleasePolicy
+}
+
+func newSubscriber[T any](id SubscriberID, stack string, options []SubscriberOption) *subscriber[T] {
+	config := subscriberConfig{
+		maxInFlight: 0,
+		overflow:    OverflowBlock,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+	var slots chan struct{}
+	if config.maxInFlight > 0 {
+		slots = make(chan struct{}, config.maxInFlight)
+	}
+	return &subscriber[T]{
+		channel:  newChannel[Ackable[T]](),
+		id:       id,
+		stack:    stack,
+		overflow: config.overflow,
+		slots:    slots,
+		buffer:   newFIFO[*delivery[T]](),
+
+		outstandingMu: sync.Mutex{},
+		outstanding:   map[*delivery[T]]uint64{},
+	}
+}
+
+// deliver sends copies to the subscriber one after another, no other copy is sent in between
+// (except redeliveries). If the subscriber is not ready, it sends the rest of them in a new goroutine
+// or puts them to the buffer, see [OverflowBuffer]. send is incremented for each started goroutine (if not nil).
+// It must be called under [channel.lock].
+func (s *subscriber[T]) deliver(ds []*delivery[T], send *sync.WaitGroup) {
+	if s.slots != nil && s.overflow == OverflowBuffer {
+		s.enqueue(ds)
+		return
+	}
+	locked := s.sending.TryLock()
+	if locked {
+		ds = s.tryDeliver(ds)
+		if len(ds) == 0 {
+			s.sending.Unlock()
+			return
+		}
+	}
+	s.deliverLater(ds, locked, send)
+}
+
+// deliverLater sends copies in a new goroutine. locked tells if sending is already locked by the caller.
+// It copies ds to not allocate it on heap if the subscriber is ready.
+func (s *subscriber[T]) deliverLater(ds []*delivery[T], locked bool, send *sync.WaitGroup) {
+	later := make([]*delivery[T], len(ds))
+	copy(later, ds)
+	if send != nil {
+		send.Add(1)
+	}
+	s.send.Add(1)
+	go func() {
+		if send != nil {
+			defer send.Done()
+		}
+		defer s.send.Done()
+		if !locked {
+			s.sending.Lock()
+		}
+		defer s.sending.Unlock()
+		for i, d := range later {
+			if !s.deliverWait(d) {
+				for _, rest := range later[i+1:] {
+					rest.resolve(rest.seq, outcomeReleased, nil)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// tryDeliver sends copies while the subscriber is ready to receive them. It returns not sent copies.
+// It must be called with sending locked.
+func (s *subscriber[T]) tryDeliver(ds []*delivery[T]) []*delivery[T] {
+	for len(ds) > 0 {
+		d := ds[0]
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+				d.holdSlot(d.seq)
+			default:
+				return ds
+			}
+		}
+		copied := d.handoff()
+		select {
+		case s.ch <- copied:
+			d.delivered(copied.seq)
+			ds = ds[1:]
+		default:
+			d.takeBack(copied)
+			d.freeSlot(copied.seq)
+			return ds
+		}
+	}
+	return ds
+}
+
+// deliverWait sends the copy waiting for a slot and for the subscriber to receive it.
+// It returns false if the subscriber is released, the copy is resolved in this case.
+// It must be called with sending locked.
+func (s *subscriber[T]) deliverWait(d *delivery[T]) bool {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			d.holdSlot(d.seq)
+		case <-s.done:
+			d.resolve(d.seq, outcomeReleased, nil)
+			return false
+		}
+	}
+	copied := d.handoff()
+	select {
+	case s.ch <- copied:
+		d.delivered(copied.seq)
+		return true
+	case <-s.done:
+		d.resolve(copied.seq, outcomeReleased, nil)
+		return false
+	}
+}
+
+// redeliver sends the copy again after its ack deadline is exceeded. The expired copy gives its slot back,
+// so the redelivered one waits for a slot and for other sends like a new copy.
+// It stops when resolved is closed, i.e. a previous copy is acked meanwhile.
+func (s *subscriber[T]) redeliver(d *delivery[T], seq uint64, resolved <-chan struct{}) {
+	d.freeSlot(seq)
+	s.sending.Lock()
+	defer s.sending.Unlock()
+	select {
+	case <-resolved:
+		return
+	default:
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			if !d.holdSlot(seq) {
+				return
+			}
+		case <-resolved:
+			return
+		case <-s.done:
+			d.resolve(seq, outcomeReleased, nil)
+			return
+		}
+	}
+	copied, ok := d.rehandoff(seq)
+	if !ok {
+		return
+	}
+	select {
+	case s.ch <- copied:
+		d.delivered(seq)
+	case <-resolved:
+	case <-s.done:
+		d.resolve(seq, outcomeReleased, nil)
+	}
+}
+
+// enqueue sends copies without blocking while the buffer is empty and the subscriber is ready,
+// the rest of them are put to the buffer.
+// It must be called under [channel.lock].
+func (s *subscriber[T]) enqueue(ds []*delivery[T]) {
+	s.buffer.mu.Lock()
+	defer s.buffer.mu.Unlock()
+	if s.buffer.idle() && s.sending.TryLock() {
+		ds = s.tryDeliver(ds)
+		s.sending.Unlock()
+	}
+	if len(ds) == 0 {
+		return
+	}
+	if !s.buffer.draining {
+		s.send.Add(1)
+		s.buffer.draining = true
+		go s.drain()
+	}
+	s.buffer.items = append(s.buffer.items, ds...)
+}
+
+// drain delivers buffered copies one by one.
+func (s *subscriber[T]) drain() {
+	defer s.send.Done()
+	for {
+		d, ok := s.buffer.popOrStop()
+		if !ok {
+			return
+		}
+		s.sending.Lock()
+		s.deliverWait(d)
+		s.sending.Unlock()
+	}
+}
+
+// ReleasePolicy defines what happens with copies received but not acked by a subscriber when it's released.
+// Copies not received before release are always considered acked with nil error.
+type ReleasePolicy int
+
+const (
+	// ReleaseWaitAck keeps such copies pending until they are acked. It's the default policy.
+	ReleaseWaitAck ReleasePolicy = iota
+	// ReleaseAck considers such copies acked with nil error.
+	ReleaseAck
+	// ReleaseFail considers such copies acked with [ErrReleased].
+	ReleaseFail
+	// ReleaseRequeue delivers such copies to another subscriber of the group.
+	// The first subscriber in the order of acquiring is chosen.
+	// If there are no other subscribers, the copy is considered acked with nil error.
+	ReleaseRequeue
+)
+
+// ErrReleased is the result of a copy which is not acked before release, see [ReleaseFail].
+var ErrReleased = errors.New("changroup: subscriber is released without ack")
+
+// WithReleasePolicy sets what happens with copies received but not acked by a subscriber when it's released.
+// Acks of resolved copies have no effect.
+func WithReleasePolicy[T any](policy ReleasePolicy) AckableGroupOption[T] {
+	return func(c *ackableGroupConfig[T]) {
+		c.release = policy
+	}
+}
+
+// resolveOutstanding resolves received but not acked copies of released subscriber according to [ReleasePolicy].
+func (g *AckableGroup[T]) resolveOutstanding(sub *subscriber[T]) {
+	if g.config.release == ReleaseWaitAck {
+		return
+	}
+	for _, o := range sub.takeOutstanding() {
+		d := o.delivery
+		switch g.config.release {
+		case ReleaseWaitAck, ReleaseAck:
+			d.resolve(o.seq, outcomeReleased, nil)
+		case ReleaseFail:
+			d.resolve(o.seq, outcomeReleased, ErrReleased)
+		case ReleaseRequeue:
+			requeued := false
+			for _, other := range g.channels.Snapshot() {
+				if !other.lock() {
+					continue
+				}
+				requeued = true
+				if r := d.msg.requeue(d, o.seq, other); r != nil {
+					other.deliver([]*delivery[T]{r}, nil)
+				}
+				other.unlock()
+				break
+			}
+			if !requeued {
+				d.resolve(o.seq, outcomeReleased, nil)
+			}
+		}
+	}
+}
+
+// track remembers received but not acked copy of message with seq.
+func (s *subscriber[T]) track(d *delivery[T], seq uint64) {
+	s.outstandingMu.Lock()
+	defer s.outstandingMu.Unlock()
+	s.outstanding[d] = seq
+}
+
+// untrack forgets resolved copy.
+func (s *subscriber[T]) untrack(d *delivery[T]) {
+	s.outstandingMu.Lock()
+	defer s.outstandingMu.Unlock()
+	delete(s.outstanding, d)
+}
+
+// outstandingCopy is a received but not acked copy, see [subscriber.takeOutstanding].
+type outstandingCopy[T any] struct {
+	delivery *delivery[T]
+	seq      uint64
+}
+
+// takeOutstanding returns received but not acked copies in the order they were sent.
+func (s *subscriber[T]) takeOutstanding() []outstandingCopy[T] {
+	s.outstandingMu.Lock()
+	defer s.outstandingMu.Unlock()
+	taken := make([]outstandingCopy[T], 0, len(s.outstanding))
+	for d, seq := range s.outstanding {
+		taken = append(taken, outstandingCopy[T]{delivery: d, seq: seq})
+	}
+	s.outstanding = map[*delivery[T]]uint64{}
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].seq < taken[j].seq
+	})
+	return taken
+}
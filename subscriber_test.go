@@ -0,0 +1,200 @@
+package changroup_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestWithMaxInFlight(t *testing.T) {
+	t.Parallel()
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBlock))
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			group.Send(changroup.NewAckable(1, func(error) {}))
+			group.Send(changroup.NewAckable(2, func(error) {}))
+		}()
+		r1 := waitChan(t, ch)
+		require.Equal(t, 1, r1.Value)
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, ch)
+		assertChanBlocked(t, sent)
+		r1.Ack(nil)
+		require.Equal(t, 2, waitChan(t, ch).Value)
+		waitChan(t, sent)
+	})
+	t.Run("redelivered copy waits for a slot", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithAckDeadline[int](50*time.Millisecond, 1))
+		ch, _ := group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBlock))
+		done := make(chan struct{})
+		go func() {
+			group.Send(changroup.NewAckable(1, func(error) { close(done) }))
+			group.Send(changroup.NewAckable(2, func(error) {}))
+		}()
+		require.Equal(t, 1, waitChan(t, ch).Value)
+		r2 := waitChan(t, ch) // the expired copy gave its slot back
+		require.Equal(t, 2, r2.Value)
+		r2.Ack(nil)
+		r1 := waitChan(t, ch)
+		require.Equal(t, 1, r1.Value)
+		r1.Ack(nil)
+		waitChan(t, done)
+	})
+	t.Run("buffer", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, _ := group.Acquire(changroup.WithMaxInFlight(2, changroup.OverflowBuffer))
+		received := make(chan changroup.Ackable[int], 10)
+		go func() {
+			for a := range ch {
+				received <- a
+			}
+		}()
+		for i := 1; i <= 5; i++ {
+			assertDoesNotStuck(t, group.Send, changroup.NewAckable(i, func(error) {}))
+		}
+		r1 := waitChan(t, received)
+		r2 := waitChan(t, received)
+		require.Equal(t, 1, r1.Value)
+		require.Equal(t, 2, r2.Value)
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, received)
+		r2.Ack(nil)
+		r3 := waitChan(t, received)
+		require.Equal(t, 3, r3.Value)
+		assertChanBlocked(t, received)
+		r1.Ack(nil)
+		r3.Ack(nil)
+		require.Equal(t, 4, waitChan(t, received).Value)
+		require.Equal(t, 5, waitChan(t, received).Value)
+	})
+	t.Run("released before receiving", func(t *testing.T) {
+		t.Parallel()
+		for _, overflow := range []changroup.OverflowPolicy{changroup.OverflowBlock, changroup.OverflowBuffer} {
+			group := changroup.NewAckableGroup[int]()
+			ch, release := group.Acquire(changroup.WithMaxInFlight(1, overflow))
+			acked := make(chan struct{}, 2)
+			group.SendAsync(changroup.NewAckable(1, func(error) { acked <- struct{}{} }))
+			group.SendAsync(changroup.NewAckable(2, func(error) { acked <- struct{}{} }))
+			require.Contains(t, []int{1, 2}, waitChan(t, ch).Value)
+			release()
+			waitChan(t, acked) // not received copy is resolved by release
+		}
+	})
+	t.Run("doesn't limit other subscribers", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		limited, _ := group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBuffer))
+		unlimited, _ := group.Acquire()
+		go func() {
+			for range limited { //nolint:revive // never ack
+			}
+		}()
+		for i := 1; i <= 3; i++ {
+			go group.Send(changroup.NewAckable(i, func(error) {}))
+			waitChan(t, unlimited)
+		}
+	})
+}
+
+func TestWithReleasePolicy(t *testing.T) {
+	t.Parallel()
+	t.Run("wait ack", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		ch, release := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		r := waitChan(t, ch)
+		release()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, done)
+		r.Ack(nil)
+		require.NoError(t, waitChan(t, done))
+	})
+	t.Run("ack", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithReleasePolicy[int](changroup.ReleaseAck))
+		id, ch, release := group.AcquireWithID()
+		done := make(chan changroup.AckReport, 1)
+		go func() {
+			report, err := group.SendAndWait(context.Background(), 1)
+			assert.NoError(t, err)
+			done <- report
+		}()
+		r := waitChan(t, ch)
+		release()
+		report := waitChan(t, done)
+		require.Equal(t, []changroup.SubscriberID{id}, report.Released)
+		r.Ack(errors.New("ignored"))
+	})
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithReleasePolicy[int](changroup.ReleaseFail))
+		ch1, release1 := group.Acquire()
+		ch2, _ := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch1)
+		waitChan(t, ch2).Ack(nil)
+		release1()
+		require.True(t, errors.Is(waitChan(t, done), changroup.ErrReleased))
+	})
+	t.Run("requeue", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithReleasePolicy[int](changroup.ReleaseRequeue))
+		id1, ch1, release1 := group.AcquireWithID()
+		id2, ch2, _ := group.AcquireWithID()
+		done := make(chan changroup.AckReport, 1)
+		go func() {
+			report, err := group.SendAndWait(context.Background(), 1)
+			assert.NoError(t, err)
+			done <- report
+		}()
+		waitChan(t, ch1)
+		waitChan(t, ch2).Ack(nil)
+		release1()
+		r := waitChan(t, ch2) // requeued copy
+		require.Equal(t, 1, r.Value)
+		assertChanBlocked(t, done)
+		r.Ack(nil)
+		report := waitChan(t, done)
+		require.Equal(t, []changroup.SubscriberID{id2, id2}, report.Acked)
+		require.Equal(t, []changroup.SubscriberID{id1}, report.Requeued)
+	})
+	t.Run("requeue without other subscribers", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithReleasePolicy[int](changroup.ReleaseRequeue))
+		ch, release := group.Acquire()
+		done := make(chan error, 1)
+		group.SendAsync(changroup.NewAckable(1, func(err error) { done <- err }))
+		waitChan(t, ch)
+		release()
+		require.NoError(t, waitChan(t, done))
+	})
+	t.Run("requeued copy respects max in-flight", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup(changroup.WithReleasePolicy[int](changroup.ReleaseRequeue))
+		ch1, release1 := group.Acquire()
+		ch2, _ := group.Acquire(changroup.WithMaxInFlight(1, changroup.OverflowBlock))
+		group.SendAsync(changroup.NewAckable(1, func(error) {}))
+		waitChan(t, ch1)
+		r := waitChan(t, ch2)
+		release1()
+		time.Sleep(50 * time.Millisecond)
+		assertChanBlocked(t, ch2) // requeued copy waits for a slot
+		r.Ack(nil)
+		require.Equal(t, 1, waitChan(t, ch2).Value)
+	})
+}
@@ -0,0 +1,455 @@
+package changroup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walExt        = ".wal"
+	walHeaderSize = 8       // payload length and CRC-32 of payload, both little-endian uint32
+	walMaxRecord  = 1 << 30 // records longer than this are considered corrupted
+)
+
+var errCorruptRecord = errors.New("changroup: corrupt log record")
+
+// wal is a segmented append-only log of records stored in a directory.
+//
+// Each segment is a file named by the offset of its first record. Only the last segment is appended.
+// A torn record at the end of the last segment (e.g. after crash) is truncated on open.
+type wal struct {
+	dir         string
+	segmentSize int64
+	syncEach    bool
+	mu          sync.Mutex
+	segments    []uint64        // first offsets of segments in ascending order
+	sealed      []sealedSegment // all segments except the last one in the same order
+	file        *os.File        // the last segment, nil if the log is closed
+	size        int64           // size of the last segment
+	next        uint64          // offset of the next record
+	dirty       bool            // there are writes not synced to disk
+}
+
+// sealedSegment is a segment which is not appended anymore.
+type sealedSegment struct {
+	size     int64
+	modified time.Time // time of the last write
+}
+
+func openWAL(dir string, segmentSize int64, syncEach bool) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil { //nolint:mnd // rwxr-x---
+		return nil, fmt.Errorf("changroup: create log directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("changroup: read log directory: %w", err)
+	}
+	w := &wal{
+		dir:         dir,
+		segmentSize: segmentSize,
+		syncEach:    syncEach,
+		mu:          sync.Mutex{},
+		segments:    nil,
+		sealed:      nil,
+		file:        nil,
+		size:        0,
+		next:        0,
+		dirty:       false,
+	}
+	// names are zero padded, so entries sorted by name are sorted by offset
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, walExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, first)
+	}
+	if len(w.segments) == 0 {
+		if err := w.createSegment(0); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	for _, first := range w.segments[:len(w.segments)-1] {
+		info, err := os.Stat(w.path(first))
+		if err != nil {
+			return nil, fmt.Errorf("changroup: stat log segment: %w", err)
+		}
+		w.sealed = append(w.sealed, sealedSegment{size: info.Size(), modified: info.ModTime()})
+	}
+	if err := w.openLastSegment(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// openLastSegment opens the last segment for appending and truncates a torn record at its end.
+func (w *wal) openLastSegment() error {
+	first := w.segments[len(w.segments)-1]
+	file, err := os.OpenFile(w.path(first), os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("changroup: open log segment: %w", err)
+	}
+	count, size, err := scanSegment(file)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("changroup: recover log segment: %w", err)
+	}
+	w.file = file
+	w.size = size
+	w.next = first + count
+	return nil
+}
+
+// createSegment creates a new last segment starting from the offset.
+func (w *wal) createSegment(first uint64) error {
+	file, err := os.OpenFile(w.path(first), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o640) //nolint:mnd // rw-r-----
+	if err != nil {
+		return fmt.Errorf("changroup: create log segment: %w", err)
+	}
+	if err := syncDir(w.dir); err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.segments = append(w.segments, first)
+	w.file = file
+	w.size = 0
+	w.next = first
+	return nil
+}
+
+func (w *wal) path(first uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", first, walExt))
+}
+
+// append writes the record to the end of the log and returns its offset.
+func (w *wal) append(data []byte) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, ErrClosed
+	}
+	record := make([]byte, walHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[walHeaderSize:], data)
+
+	if w.size > 0 && w.size+int64(len(record)) > w.segmentSize {
+		if err := w.roll(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := w.file.Write(record); err != nil {
+		// best effort to not leave a torn record in the middle of the log
+		_ = w.file.Truncate(w.size)
+		_, _ = w.file.Seek(w.size, io.SeekStart)
+		return 0, fmt.Errorf("changroup: write log record: %w", err)
+	}
+	w.dirty = true
+	if w.syncEach {
+		if err := w.syncLocked(); err != nil {
+			// the record is not acknowledged, so it must not be read or replayed after restart
+			_ = w.file.Truncate(w.size)
+			_, _ = w.file.Seek(w.size, io.SeekStart)
+			return 0, err
+		}
+	}
+	offset := w.next
+	w.next++
+	w.size += int64(len(record))
+	return offset, nil
+}
+
+// roll closes the last segment and starts a new one. It must be called under lock.
+func (w *wal) roll() error {
+	if err := w.syncLocked(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("changroup: close log segment: %w", err)
+	}
+	sealed := sealedSegment{size: w.size, modified: time.Now()}
+	if err := w.createSegment(w.next); err != nil {
+		return err
+	}
+	w.sealed = append(w.sealed, sealed)
+	return nil
+}
+
+// trim deletes the oldest segments while the total size of the log is larger than maxBytes
+// or the last write to the segment is older than maxAge. Zero limit is ignored. The last segment is never deleted.
+func (w *wal) trim(maxBytes int64, maxAge time.Duration, now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	total := w.size
+	for _, s := range w.sealed {
+		total += s.size
+	}
+	n := 0
+	for ; n < len(w.sealed); n++ {
+		s := w.sealed[n]
+		if (maxBytes <= 0 || total <= maxBytes) && (maxAge <= 0 || now.Sub(s.modified) <= maxAge) {
+			break
+		}
+		total -= s.size
+	}
+	return w.deleteLocked(n)
+}
+
+// deleteBefore deletes segments containing only records before the offset. The last segment is never deleted.
+func (w *wal) deleteBefore(offset uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for n+1 < len(w.segments) && w.segments[n+1] <= offset {
+		n++
+	}
+	return w.deleteLocked(n)
+}
+
+// deleteLocked deletes n oldest segments. It must be called under lock.
+// Readers which already opened a deleted segment may still read it on most OSes.
+func (w *wal) deleteLocked(n int) error {
+	for ; n > 0; n-- {
+		if err := os.Remove(w.path(w.segments[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("changroup: delete log segment: %w", err)
+		}
+		w.segments = w.segments[1:]
+		w.sealed = w.sealed[1:]
+	}
+	return nil
+}
+
+// sync flushes written records to disk.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.syncLocked()
+}
+
+func (w *wal) syncLocked() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("changroup: sync log segment: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// syncEvery flushes written records to disk periodically until stop is closed.
+func (w *wal) syncEvery(interval time.Duration, stop <-chan struct{}, handleError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.sync(); err != nil {
+				handleError(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// bounds returns the offset of the first record and the offset of the next record.
+func (w *wal) bounds() (uint64, uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.segments[0], w.next
+}
+
+// read calls fn for each record from offset from (inclusive) to offset to (exclusive).
+// Records before to must be already written. It stops at the first error returned by fn.
+func (w *wal) read(from, to uint64, fn func(offset uint64, data []byte) error) error {
+	r := w.reader(from)
+	defer r.close()
+	for offset := from; offset < to; offset++ {
+		data, err := r.read()
+		if err != nil {
+			return err
+		}
+		if err := fn(offset, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reader returns a reader of records starting from the offset. It must be closed after use.
+func (w *wal) reader(from uint64) *walReader {
+	return &walReader{
+		w:      w,
+		file:   nil,
+		r:      nil,
+		end:    0,
+		offset: from,
+	}
+}
+
+// walReader reads records of wal sequentially. It keeps the segment open between reads, so it's cheap
+// to follow the end of the log.
+type walReader struct {
+	w      *wal
+	file   *os.File // the segment containing offset, nil if it's not opened yet
+	r      *bufio.Reader
+	end    uint64 // the first offset of the next segment, or max uint64 if the segment is the last one
+	offset uint64 // offset of the next record
+}
+
+// read returns the record at the current offset and moves to the next one. The record must be already written.
+func (r *walReader) read() ([]byte, error) {
+	if r.file == nil || r.offset >= r.end {
+		if err := r.open(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := readRecord(r.r)
+	if errors.Is(err, io.EOF) {
+		// the segment was the last one when it was opened, the record is in the next segment
+		if err = r.open(); err == nil {
+			data, err = readRecord(r.r)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("changroup: read log record %d: %w", r.offset, err)
+	}
+	r.offset++
+	return data, nil
+}
+
+// open opens the segment containing the current offset and skips records before it.
+func (r *walReader) open() error {
+	r.close()
+	r.w.mu.Lock()
+	i := sort.Search(len(r.w.segments), func(i int) bool { return r.w.segments[i] > r.offset }) - 1
+	first, end := uint64(0), uint64(math.MaxUint64)
+	if i >= 0 {
+		first = r.w.segments[i]
+	}
+	if i+1 < len(r.w.segments) {
+		end = r.w.segments[i+1]
+	}
+	r.w.mu.Unlock()
+	if i < 0 {
+		return fmt.Errorf("changroup: log record %d is not found", r.offset)
+	}
+	file, err := os.Open(r.w.path(first))
+	if err != nil {
+		return fmt.Errorf("changroup: open log segment: %w", err)
+	}
+	r.file = file
+	r.r = bufio.NewReader(file)
+	r.end = end
+	for offset := first; offset < r.offset; offset++ {
+		if _, err := readRecord(r.r); err != nil {
+			return fmt.Errorf("changroup: read log record %d: %w", offset, err)
+		}
+	}
+	return nil
+}
+
+func (r *walReader) close() {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+		r.r = nil
+	}
+}
+
+// close syncs and closes the log. append returns [ErrClosed] after that, but the log still can be read.
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.syncLocked()
+	if closeErr := w.file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("changroup: close log segment: %w", closeErr)
+	}
+	w.file = nil
+	return err
+}
+
+// readRecord reads the next record. It returns [io.EOF] if there are no more records,
+// [io.ErrUnexpectedEOF] or errCorruptRecord if the record is torn.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if length > walMaxRecord {
+		return nil, errCorruptRecord
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err //nolint:wrapcheck // it's wrapped by caller
+	}
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, errCorruptRecord
+	}
+	return data, nil
+}
+
+// scanSegment returns the number of valid records and their total size. A torn record at the end is ignored.
+func scanSegment(file *os.File) (uint64, int64, error) {
+	r := bufio.NewReader(file)
+	count := uint64(0)
+	size := int64(0)
+	for {
+		data, err := readRecord(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errCorruptRecord) {
+			return count, size, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		count++
+		size += walHeaderSize + int64(len(data))
+	}
+}
+
+// syncDir flushes directory entries to disk, so created files survive crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("changroup: open log directory: %w", err)
+	}
+	defer func() { _ = d.Close() }()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("changroup: sync log directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package changroup
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAL(t *testing.T) {
+	t.Parallel()
+	t.Run("reads range across segments", func(t *testing.T) {
+		t.Parallel()
+		w, err := openWAL(t.TempDir(), 20, false)
+		require.NoError(t, err)
+		defer w.close()
+		for i := 0; i < 10; i++ {
+			offset, err := w.append([]byte(strconv.Itoa(i)))
+			require.NoError(t, err)
+			require.Equal(t, uint64(i), offset)
+		}
+		require.Greater(t, len(w.segments), 2)
+		first, next := w.bounds()
+		require.Equal(t, uint64(0), first)
+		require.Equal(t, uint64(10), next)
+		var read []string
+		require.NoError(t, w.read(3, 8, func(offset uint64, data []byte) error {
+			require.Equal(t, strconv.Itoa(int(offset)), string(data))
+			read = append(read, string(data))
+			return nil
+		}))
+		require.Equal(t, []string{"3", "4", "5", "6", "7"}, read)
+	})
+	t.Run("continues after reopen", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		w, err := openWAL(dir, 20, true)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			_, err := w.append([]byte{byte(i)})
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.close())
+		_, err = w.append([]byte{0})
+		require.Equal(t, ErrClosed, err)
+
+		w, err = openWAL(dir, 20, true)
+		require.NoError(t, err)
+		defer w.close()
+		offset, err := w.append([]byte{5})
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), offset)
+		var read []byte
+		require.NoError(t, w.read(0, 6, func(_ uint64, data []byte) error {
+			read = append(read, data...)
+			return nil
+		}))
+		require.Equal(t, []byte{0, 1, 2, 3, 4, 5}, read)
+	})
+	t.Run("trim deletes the oldest segments", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		w, err := openWAL(dir, 1, false) // each record is in its own segment of 9 bytes
+		require.NoError(t, err)
+		defer w.close()
+		for i := 0; i < 5; i++ {
+			_, err := w.append([]byte{byte(i)})
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.trim(30, 0, time.Now()))
+		first, next := w.bounds()
+		require.Equal(t, uint64(2), first)
+		require.Equal(t, uint64(5), next)
+		require.NoError(t, w.trim(0, time.Hour, time.Now()))
+		require.Len(t, w.segments, 3)
+		require.NoError(t, w.trim(0, time.Hour, time.Now().Add(2*time.Hour)))
+		require.Equal(t, []uint64{4}, w.segments) // the last segment is never deleted
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		w, err = openWAL(dir, 1, false)
+		require.NoError(t, err)
+		defer w.close()
+		first, next = w.bounds()
+		require.Equal(t, uint64(4), first)
+		require.Equal(t, uint64(5), next)
+	})
+	t.Run("deleteBefore keeps segments with the offset", func(t *testing.T) {
+		t.Parallel()
+		w, err := openWAL(t.TempDir(), 20, false) // two records in each segment
+		require.NoError(t, err)
+		defer w.close()
+		for i := 0; i < 6; i++ {
+			_, err := w.append([]byte{byte(i)})
+			require.NoError(t, err)
+		}
+		require.Equal(t, []uint64{0, 2, 4}, w.segments)
+		require.NoError(t, w.deleteBefore(3))
+		require.Equal(t, []uint64{2, 4}, w.segments)
+		require.NoError(t, w.deleteBefore(10))
+		require.Equal(t, []uint64{4}, w.segments)
+		require.NoError(t, w.read(4, 6, func(uint64, []byte) error { return nil }))
+	})
+}
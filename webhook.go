@@ -0,0 +1,123 @@
+package changroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WebhookHandler publishes values POSTed to it into a group. Request body is decoded by the codec.
+//
+// It responds with 400 Bad Request if the body can't be decoded
+// and with 413 Request Entity Too Large if the body is too large, see [WithMaxBodySize].
+type WebhookHandler[T any] struct {
+	group   *Group[T]
+	ackable *AckableGroup[T]
+	codec   Codec[T]
+	config  httpConfig
+	sends   chan struct{} // tokens of sends to the plain group including abandoned ones, see WithMaxPendingSends
+}
+
+// NewWebhookHandler creates a handler which sends values to the group like [Group.Send].
+// It responds with 202 Accepted after all subscribers receive the value
+// and with 503 Service Unavailable if not all subscribers receive it in time, see [WithAckTimeout].
+// The value is still sent to the rest of subscribers in background in that case.
+// Such sends are limited, see [WithMaxPendingSends].
+func NewWebhookHandler[T any](group *Group[T], codec Codec[T], options ...HTTPOption) *WebhookHandler[T] {
+	config := newHTTPConfig(options)
+	return &WebhookHandler[T]{
+		group:   group,
+		ackable: nil,
+		codec:   codec,
+		config:  config,
+		sends:   make(chan struct{}, config.maxSends),
+	}
+}
+
+// NewAckableWebhookHandler creates a handler which sends values to the group like [AckableGroup.SendAndWait].
+//
+// It responds with 204 No Content after all subscribers ack the value with nil error.
+// It responds with 500 Internal Server Error if any subscriber acks with an error (the error is passed to
+// [WithHTTPErrorHandler]) and with 503 Service Unavailable if not all subscribers ack in time, see [WithAckTimeout].
+func NewAckableWebhookHandler[T any](group *AckableGroup[T], codec Codec[T], options ...HTTPOption) *WebhookHandler[T] {
+	return &WebhookHandler[T]{
+		group:   nil,
+		ackable: group,
+		codec:   codec,
+		config:  newHTTPConfig(options),
+		sends:   nil,
+	}
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *WebhookHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.config.maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	value, err := h.codec.Decode(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.ackTimeout)
+	defer cancel()
+	if h.group != nil {
+		err = h.send(ctx, value)
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case r.Context().Err() != nil: // the client is gone
+		default:
+			http.Error(w, "value is not received in time", http.StatusServiceUnavailable)
+		}
+		return
+	}
+	_, err = h.ackable.SendAndWait(ctx, value)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case r.Context().Err() != nil: // the client is gone
+	case err == ctx.Err(): //nolint:errorlint // SendAndWait returns ctx.Err() as is, wrapped errors are acks
+		http.Error(w, "value is not acked in time", http.StatusServiceUnavailable)
+	default:
+		h.config.handleError(fmt.Errorf("changroup: webhook value is acked with error: %w", err))
+		http.Error(w, "value is not processed", http.StatusInternalServerError)
+	}
+}
+
+// send sends the value like [Group.Send], but returns the context error if the context is done earlier.
+// The value is still sent in background in that case, like [Group.SendAsync] does.
+// It waits for a token of sends first, so the number of sends in background is limited.
+func (h *WebhookHandler[T]) send(ctx context.Context, value T) error {
+	select {
+	case h.sends <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	sent := make(chan struct{})
+	go func() {
+		defer func() { <-h.sends }()
+		defer close(sent)
+		h.group.Send(value)
+	}()
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
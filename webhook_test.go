@@ -0,0 +1,144 @@
+package changroup_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maratori/changroup"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	t.Parallel()
+	t.Run("publishes value", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		server := httptest.NewServer(changroup.NewWebhookHandler[int](group, changroup.JSONCodec[int]{}))
+		defer server.Close()
+		ch, _ := group.Acquire()
+		status := make(chan int)
+		go func() { status <- post(t, server.URL, "42") }()
+		require.Equal(t, 42, waitChan(t, ch))
+		require.Equal(t, http.StatusAccepted, waitChan(t, status))
+	})
+	t.Run("send timeout", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		server := httptest.NewServer(changroup.NewWebhookHandler[int](group, changroup.JSONCodec[int]{},
+			changroup.WithAckTimeout(10*time.Millisecond)))
+		defer server.Close()
+		ch, _ := group.Acquire()
+		require.Equal(t, http.StatusServiceUnavailable, post(t, server.URL, "42"))
+		require.Equal(t, 42, waitChan(t, ch)) // the value is still sent
+	})
+	t.Run("pending sends are limited", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		server := httptest.NewServer(changroup.NewWebhookHandler[int](group, changroup.JSONCodec[int]{},
+			changroup.WithAckTimeout(10*time.Millisecond), changroup.WithMaxPendingSends(1)))
+		defer server.Close()
+		ch, _ := group.Acquire()
+		require.Equal(t, http.StatusServiceUnavailable, post(t, server.URL, "1"))
+		require.Equal(t, http.StatusServiceUnavailable, post(t, server.URL, "2")) // the first send is still pending
+		require.Equal(t, 1, waitChan(t, ch))
+		status := make(chan int)
+		go func() { status <- post(t, server.URL, "3") }()
+		require.Equal(t, 3, waitChan(t, ch)) // the second value is not sent
+		require.Equal(t, http.StatusAccepted, waitChan(t, status))
+	})
+	t.Run("bad requests", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewGroup[int]()
+		server := httptest.NewServer(changroup.NewWebhookHandler[int](group, changroup.JSONCodec[int]{},
+			changroup.WithMaxBodySize(4)))
+		defer server.Close()
+		require.Equal(t, http.StatusBadRequest, post(t, server.URL, "abc"))
+		require.Equal(t, http.StatusRequestEntityTooLarge, post(t, server.URL, "123456"))
+		resp, err := http.Get(server.URL) //nolint:noctx // test
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestAckableWebhookHandler(t *testing.T) {
+	t.Parallel()
+	t.Run("waits for acks", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		server := httptest.NewServer(changroup.NewAckableWebhookHandler[int](group, changroup.JSONCodec[int]{}))
+		defer server.Close()
+		ch1, _ := group.Acquire()
+		ch2, _ := group.Acquire()
+		status := make(chan int)
+		go func() { status <- post(t, server.URL, "1") }()
+		v1 := waitChan(t, ch1)
+		v2 := waitChan(t, ch2)
+		require.Equal(t, 1, v1.Value)
+		v1.Ack(nil)
+		time.Sleep(10 * time.Millisecond)
+		assertChanBlocked(t, status)
+		v2.Ack(nil)
+		require.Equal(t, http.StatusNoContent, waitChan(t, status))
+	})
+	t.Run("no subscribers", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		server := httptest.NewServer(changroup.NewAckableWebhookHandler[int](group, changroup.JSONCodec[int]{}))
+		defer server.Close()
+		require.Equal(t, http.StatusNoContent, post(t, server.URL, "1"))
+	})
+	t.Run("ack timeout", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		server := httptest.NewServer(changroup.NewAckableWebhookHandler[int](group, changroup.JSONCodec[int]{},
+			changroup.WithAckTimeout(10*time.Millisecond)))
+		defer server.Close()
+		_, _ = group.Acquire()
+		require.Equal(t, http.StatusServiceUnavailable, post(t, server.URL, "1"))
+	})
+	t.Run("ack error", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		errs := make(chan error, 1)
+		server := httptest.NewServer(changroup.NewAckableWebhookHandler[int](group, changroup.JSONCodec[int]{},
+			changroup.WithHTTPErrorHandler(func(err error) { errs <- err })))
+		defer server.Close()
+		ch, _ := group.Acquire()
+		status := make(chan int)
+		go func() { status <- post(t, server.URL, "1") }()
+		errTest := errors.New("test")
+		waitChan(t, ch).Ack(errTest)
+		require.Equal(t, http.StatusInternalServerError, waitChan(t, status))
+		require.True(t, errors.Is(waitChan(t, errs), errTest))
+	})
+	t.Run("ack with deadline error", func(t *testing.T) {
+		t.Parallel()
+		group := changroup.NewAckableGroup[int]()
+		server := httptest.NewServer(changroup.NewAckableWebhookHandler[int](group, changroup.JSONCodec[int]{}))
+		defer server.Close()
+		ch, _ := group.Acquire()
+		status := make(chan int)
+		go func() { status <- post(t, server.URL, "1") }()
+		waitChan(t, ch).Ack(context.DeadlineExceeded) // subscriber's own deadline is not the ack timeout
+		require.Equal(t, http.StatusInternalServerError, waitChan(t, status))
+	})
+}
+
+func post(t *testing.T, url, body string) int {
+	t.Helper()
+	//nolint:noctx // test
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if !assert.NoError(t, err) { // assert, because it may be called in goroutine
+		return 0
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,52 @@
+package changroup
+
+import "time"
+
+// ackWorkerIdle is how long a goroutine of [ackWorkers] waits for the next ack before it exits.
+const ackWorkerIdle = time.Second
+
+// ackWorkers calls original acks in background goroutines.
+// Goroutines are reused, so an ack doesn't start a new one while there is an idle goroutine.
+// Acks don't wait for each other, a slow ack keeps busy only its own goroutine.
+type ackWorkers[T any] struct {
+	idle chan ackCall[T] // is received by idle goroutines
+}
+
+type ackCall[T any] struct {
+	original Ackable[T]
+	err      error
+}
+
+func newAckWorkers[T any]() *ackWorkers[T] {
+	return &ackWorkers[T]{
+		idle: make(chan ackCall[T]),
+	}
+}
+
+// call acks original with err in background.
+func (w *ackWorkers[T]) call(original Ackable[T], err error) {
+	c := ackCall[T]{original: original, err: err}
+	select {
+	case w.idle <- c:
+	default:
+		go w.run(c)
+	}
+}
+
+// run calls acks until there is no new one for [ackWorkerIdle].
+func (w *ackWorkers[T]) run(c ackCall[T]) {
+	timer := time.NewTimer(ackWorkerIdle)
+	defer timer.Stop()
+	for {
+		c.original.Ack(c.err)
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(ackWorkerIdle)
+		select {
+		case c = <-w.idle:
+		case <-timer.C:
+			return
+		}
+	}
+}